@@ -1,4 +1,4 @@
-// package bufin implements a partially static buffed input reader. It is very
+// package bufin implements a buffered input reader. It is very
 // similar to the standard library bufio.Reader so that is almost always
 // prefered over the following package. bufin is implemented to track and have
 // full control over reading data from a socket. It's used internally by the
@@ -12,25 +12,57 @@ import (
 	"io"
 )
 
-const IOBUFLEN = 1024
+const (
+	IOBUFLEN = 1024
+
+	// DefaultSize is the size of the buffer used by NewReader.
+	DefaultSize = IOBUFLEN * 8
+
+	// DefaultMaxSize is the largest the buffer used by NewReader grows to
+	// hold a single line.
+	DefaultMaxSize = IOBUFLEN * 64
+
+	// smallest buffer accepted by NewReaderSize
+	minSize = 16
+
+	// give up on readers that keep returning no data and no error
+	maxEmptyReads = 100
+)
 
 var (
 	ErrFullBuf  = errors.New("Full buffer")
 	ErrNotFound = errors.New("Not found")
+
+	errNegativeRead  = errors.New("bufin: reader returned negative count from Read")
+	errNegativeCount = errors.New("bufin: negative count")
 )
 
 type Reader struct {
-	data        [IOBUFLEN * 8]byte
 	buf         []byte
 	rd          io.Reader
 	r, w        int
+	max         int // largest the buffer grows to
+	err         error
 	reads, movs int64
 }
 
 func NewReader(rd io.Reader) (r *Reader) {
+	return NewReaderSize(rd, DefaultSize, DefaultMaxSize)
+}
+
+// NewReaderSize returns a Reader starting with a buffer of at least size
+// bytes. The buffer grows as needed to hold long lines, up to max bytes.
+func NewReaderSize(rd io.Reader, size, max int) (r *Reader) {
+	if size < minSize {
+		size = minSize
+	}
+	if max < size {
+		max = size
+	}
 	r = new(Reader)
-	r.buf = r.data[:]
+	r.buf = make([]byte, size)
 	r.rd = rd
+	r.max = max
 	return r
 }
 
@@ -49,12 +81,21 @@ func (b *Reader) Reset() bool {
 	return false
 }
 
+// returns and clears the error from the underlying reader
+func (b *Reader) readErr() error {
+	err := b.err
+	b.err = nil
+	return err
+}
+
+// reads at least one byte into the buffer, growing it if it is full, unless
+// the underlying reader returns an error which is kept in b.err. returns
+// ErrFullBuf if the buffer is full and already at its maximum size.
 func (b *Reader) fill() error {
 	b.Reset()
 
 	if b.r > 0 {
 		// move existing data to beginning of buffer
-		//println("move")
 		copy(b.buf, b.buf[b.r:b.w])
 		b.w -= b.r
 		b.r = 0
@@ -63,21 +104,40 @@ func (b *Reader) fill() error {
 		b.movs++
 	}
 
-	if len(b.buf[b.w:]) < IOBUFLEN {
-		return ErrFullBuf
+	if b.w == len(b.buf) {
+		if len(b.buf) >= b.max {
+			return ErrFullBuf
+		}
+		size := len(b.buf) * 2
+		if size > b.max {
+			size = b.max
+		}
+		buf := make([]byte, size)
+		copy(buf, b.buf[:b.w])
+		b.buf = buf
 	}
 
-	slice := b.buf[b.w : IOBUFLEN+b.w]
-	n, e := b.rd.Read(slice)
-	b.w += n
+	for i := 0; i < maxEmptyReads; i++ {
+		n, e := b.rd.Read(b.buf[b.w:])
+		if n < 0 {
+			panic(errNegativeRead)
+		}
+		b.w += n
 
-	// statistics
-	b.reads++
+		// statistics
+		b.reads++
 
-	if e != nil {
-		return e
+		if e != nil {
+			b.err = e
+			return nil
+		}
+
+		if n > 0 {
+			return nil
+		}
 	}
 
+	b.err = io.ErrNoProgress
 	return nil
 }
 
@@ -94,26 +154,46 @@ func (b *Reader) Incr(n int) int {
 	return n
 }
 
-// either reads from the static buffer or if len(p) > len(buf),
-// read len(p) bytes from socket directly into p
+// either reads from the buffer or if it is empty and len(p) >= len(buf),
+// reads from socket directly into p
 func (b *Reader) Read(p []byte) (n int, e error) {
 	n = len(p)
 
 	if n == 0 {
-		return 0, nil
+		if b.Buffered() > 0 {
+			return 0, nil
+		}
+		return 0, b.readErr()
 	}
 
 	if b.w == b.r {
-		// read request is larger then current window size
-		if n >= len(b.buf[b.w:IOBUFLEN]) {
+		if b.err != nil {
+			return 0, b.readErr()
+		}
+
+		// read request is larger then the buffer
+		if n >= len(b.buf) {
 			n, e = b.rd.Read(p)
+			if n < 0 {
+				panic(errNegativeRead)
+			}
 			b.reads++
 			return n, e
 		}
 
-		if e = b.fill(); e != nil {
+		b.r = 0
+		b.w = 0
+		n, e = b.rd.Read(b.buf)
+		if n < 0 {
+			panic(errNegativeRead)
+		}
+		b.reads++
+		if n == 0 {
 			return 0, e
 		}
+		b.w += n
+		b.err = e
+		n = len(p)
 	}
 
 	// drain buffer
@@ -155,23 +235,70 @@ func (b *Reader) IndexSlice(delim byte) (line []byte, err error) {
 	return nil, ErrNotFound
 }
 
+// ReadSlice reads until the first occurrence of delim, returning a slice of
+// the buffer which is only valid until the next read. The buffer grows to hold
+// long lines, up to the maximum size after which ErrFullBuf is returned. If an
+// error occurs before finding delim, the data read so far is returned with it.
 func (b *Reader) ReadSlice(delim byte) (line []byte, err error) {
+	searched := 0
 	for {
-		off := b.r
-		i := bytes.IndexByte(b.buf[off:b.w], delim)
+		i := bytes.IndexByte(b.buf[b.r+searched:b.w], delim)
 
 		if i >= 0 {
-			line = b.buf[b.r : off+i+1]
-			b.r = off + i + 1
+			i += searched
+			line = b.buf[b.r : b.r+i+1]
+			b.r += i + 1
 			return line, nil
 		}
 
-		err = b.fill()
+		if b.err != nil {
+			line = b.buf[b.r:b.w]
+			b.r = b.w
+			return line, b.readErr()
+		}
+
+		// don't scan the same data again after it is moved
+		searched = b.w - b.r
 
-		if err != nil {
+		if err = b.fill(); err != nil {
 			line = b.buf[b.r:b.w]
 			b.r = b.w
 			return line, err
 		}
 	}
 }
+
+// ReadLine is like ReadSlice('\n') but drops the trailing \n or \r\n.
+func (b *Reader) ReadLine() (line []byte, err error) {
+	line, err = b.ReadSlice('\n')
+	if err != nil {
+		return line, err
+	}
+
+	line = line[:len(line)-1]
+	if len(line) > 0 && line[len(line)-1] == '\r' {
+		line = line[:len(line)-1]
+	}
+	return line, nil
+}
+
+// Peek returns the next n bytes without advancing the reader, growing the
+// buffer up to its maximum size if needed. The slice is only valid until the next read. If fewer
+// than n bytes are available, they are returned with the error explaining why.
+func (b *Reader) Peek(n int) ([]byte, error) {
+	if n < 0 {
+		return nil, errNegativeCount
+	}
+
+	for b.w-b.r < n && b.err == nil {
+		if err := b.fill(); err != nil {
+			return b.buf[b.r:b.w], err
+		}
+	}
+
+	if b.w-b.r < n {
+		return b.buf[b.r:b.w], b.readErr()
+	}
+
+	return b.buf[b.r : b.r+n], nil
+}
@@ -1,8 +1,11 @@
 package bufin
 
 import (
+	"bytes"
 	"io"
+	"strings"
 	"testing"
+	"testing/iotest"
 )
 
 type IOReader struct {
@@ -117,3 +120,126 @@ func TestReadSlice(t *testing.T) {
 		}
 	}
 }
+
+func TestReadSliceLongLine(t *testing.T) {
+	line := strings.Repeat("x", 100000) + "\r\n"
+	r := NewReaderSize(strings.NewReader(line+"+OK\r\n"), 16, 1<<20)
+
+	slice, err := r.ReadSlice('\n')
+	if err != nil || string(slice) != line {
+		t.Fatalf("expected a %d byte line got %d bytes and `%v`", len(line), len(slice), err)
+	}
+
+	slice, err = r.ReadSlice('\n')
+	if err != nil || string(slice) != "+OK\r\n" {
+		t.Fatalf("expected `+OK` got `%q` and `%v`", slice, err)
+	}
+
+	slice, err = r.ReadSlice('\n')
+	if err != io.EOF || len(slice) != 0 {
+		t.Fatalf("expected EOF got `%q` and `%v`", slice, err)
+	}
+}
+
+func TestReadSliceMaxSize(t *testing.T) {
+	r := NewReaderSize(strings.NewReader(strings.Repeat("x", 1000)), 16, 100)
+
+	slice, err := r.ReadSlice('\n')
+	if err != ErrFullBuf || len(slice) != 100 {
+		t.Fatalf("expected 100 bytes and ErrFullBuf got %d bytes and `%v`", len(slice), err)
+	}
+
+	if p, err := r.Peek(101); err != ErrFullBuf || len(p) != 100 {
+		t.Fatalf("expected 100 bytes and ErrFullBuf got %d bytes and `%v`", len(p), err)
+	}
+}
+
+func TestReadSlicePartial(t *testing.T) {
+	r := NewReaderSize(iotest.OneByteReader(strings.NewReader("$3\r\nda")), 16, DefaultMaxSize)
+
+	if slice, err := r.ReadSlice('\n'); err != nil || string(slice) != "$3\r\n" {
+		t.Fatalf("expected `$3` got `%q` and `%v`", slice, err)
+	}
+
+	if slice, err := r.ReadSlice('\n'); err != io.EOF || string(slice) != "da" {
+		t.Fatalf("expected `da` and EOF got `%q` and `%v`", slice, err)
+	}
+}
+
+func TestReadLine(t *testing.T) {
+	r := NewReaderSize(strings.NewReader("+OK\r\nunix\n\nlast"), 16, DefaultMaxSize)
+
+	for _, exp := range []string{"+OK", "unix", ""} {
+		if line, err := r.ReadLine(); err != nil || string(line) != exp {
+			t.Errorf("expected `%s` got `%q` and `%v`", exp, line, err)
+		}
+	}
+
+	if line, err := r.ReadLine(); err != io.EOF || string(line) != "last" {
+		t.Errorf("expected `last` and EOF got `%q` and `%v`", line, err)
+	}
+}
+
+func TestPeek(t *testing.T) {
+	data := strings.Repeat("0123456789", 10)
+	r := NewReaderSize(iotest.HalfReader(strings.NewReader(data)), 16, DefaultMaxSize)
+
+	if p, err := r.Peek(0); err != nil || len(p) != 0 {
+		t.Fatalf("expected nothing got `%q` and `%v`", p, err)
+	}
+
+	// larger than the buffer
+	if p, err := r.Peek(50); err != nil || string(p) != data[:50] {
+		t.Fatalf("expected `%s` got `%q` and `%v`", data[:50], p, err)
+	}
+
+	buf := make([]byte, 10)
+	if n, err := io.ReadFull(r, buf); err != nil || string(buf[:n]) != data[:10] {
+		t.Fatalf("expected `%s` got `%q` and `%v`", data[:10], buf[:n], err)
+	}
+
+	if p, err := r.Peek(100); err != io.EOF || string(p) != data[10:] {
+		t.Fatalf("expected `%s` and EOF got `%q` and `%v`", data[10:], p, err)
+	}
+
+	if _, err := r.Peek(-1); err == nil {
+		t.Fatal("expected an error for a negative count")
+	}
+}
+
+func TestIOTest(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789abcdef\r\n"), 1000)
+	wrappers := map[string]func(io.Reader) io.Reader{
+		"plain":   func(r io.Reader) io.Reader { return r },
+		"onebyte": iotest.OneByteReader,
+		"half":    iotest.HalfReader,
+		"dataerr": iotest.DataErrReader,
+	}
+
+	for name, wrap := range wrappers {
+		for _, size := range []int{16, 100, DefaultSize} {
+			r := NewReaderSize(wrap(bytes.NewReader(data)), size, DefaultMaxSize)
+			if err := iotest.TestReader(r, data); err != nil {
+				t.Errorf("%s reader with size %d: %v", name, size, err)
+			}
+		}
+	}
+}
+
+func TestReadErr(t *testing.T) {
+	r := NewReaderSize(iotest.TimeoutReader(iotest.OneByteReader(strings.NewReader("+OK\r\n"))), 16, DefaultMaxSize)
+
+	// the error is returned once with the partial line
+	if slice, err := r.ReadSlice('\n'); err != iotest.ErrTimeout || string(slice) != "+" {
+		t.Fatalf("expected `+` and timeout got `%q` and `%v`", slice, err)
+	}
+
+	if slice, err := r.ReadSlice('\n'); err != nil || string(slice) != "OK\r\n" {
+		t.Fatalf("expected `OK` got `%q` and `%v`", slice, err)
+	}
+
+	r = NewReaderSize(iotest.ErrReader(io.ErrClosedPipe), 16, DefaultMaxSize)
+	if _, err := r.ReadSlice('\n'); err != io.ErrClosedPipe {
+		t.Fatalf("expected `%v` got `%v`", io.ErrClosedPipe, err)
+	}
+}
@@ -18,22 +18,15 @@ func New(client *redis.Client) *Cache {
 
 // Store a value with the given timeout.
 func (c *Cache) Store(key string, value []byte, timeout time.Duration) error {
-	args := []interface{}{"SET", key, value}
-	if timeout != 0 {
-		args = append(args, "PX", uint64(timeout.Nanoseconds()/int64(time.Millisecond)))
-	}
-	_, err := c.client.Call(args...)
+	_, err := c.client.Set(key, value, &redis.SetOptions{Expiration: timeout})
 	return err
 }
 
 // Get a stored value. A missing value will return nil, nil.
 func (c *Cache) Get(key string) ([]byte, error) {
-	item, err := c.client.Call("GET", key)
-	if err != nil {
-		return nil, err
-	}
-	if !item.Nil() {
-		return item.Elem.Bytes(), nil
+	value, err := c.client.Get(key)
+	if err == redis.ErrNil {
+		return nil, nil
 	}
-	return nil, nil
+	return value, err
 }
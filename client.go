@@ -2,12 +2,29 @@
 package redis
 
 import (
+	"context"
+	"crypto/tls"
 	"errors"
+	"net"
 	"strings"
+	"sync"
 	"time"
 )
 
-var errPoolSizeNotSpecified = errors.New("redis client pool size not specified")
+// Added to the server side timeout of blocking commands to allow for the
+// round trip.
+const blockingMargin = time.Second
+
+var (
+	errPoolSizeNotSpecified = errors.New("redis client pool size not specified")
+
+	// ErrClientClosed is returned when using a Client after Close.
+	ErrClientClosed = errors.New("go.redis: client closed")
+
+	// ErrPoolTimeout is returned when no connection became available within
+	// the Client PoolTimeout.
+	ErrPoolTimeout = errors.New("go.redis: timed out waiting for a connection")
+)
 
 type Stats interface {
 	Inc(name string)
@@ -17,13 +34,54 @@ type Stats interface {
 // Client implements a Redis connection which is what you should typically use
 // instead of the lower level Conn interface. It implements a fixed size
 // connection pool and supports per-call timeout.
+//
+// Timeout applies to dialing, sending a command and reading its reply, unless
+// the more specific DialTimeout, WriteTimeout or ReadTimeout are set. A zero
+// timeout means no deadline.
 type Client struct {
 	Addr     string        // Server Address like "127.0.0.1:6379" or "/run/redis.sock"
 	Proto    string        // Server Protocol like "tcp" or "unix"
 	PoolSize uint          // Connection Pool Size, must be specified
 	Timeout  time.Duration // Timeout per call
 	Stats    Stats         // For Stats collection
-	pool     chan Conn
+	Protocol int           // Protocol version, 3 sends HELLO 3 on connect
+
+	DialTimeout  time.Duration // Timeout for establishing a connection
+	ReadTimeout  time.Duration // Timeout for reading a reply
+	WriteTimeout time.Duration // Timeout for sending a command
+	PoolTimeout  time.Duration // Wait for a free connection, zero waits forever
+
+	Username   string // ACL user to authenticate as, instead of the default user
+	Password   string // Password to authenticate new connections with
+	DB         int    // Database to select on new connections
+	ClientName string // Name to set on new connections
+
+	// TLSConfig enables TLS for TCP connections. Setting Certificates
+	// provides a client certificate, for servers which require one.
+	TLSConfig *tls.Config
+
+	// Dialer opens the connections instead of dialing Addr using Proto. It
+	// allows dialing through tunnels or setting socket options. The context
+	// expires after the dial timeout.
+	Dialer func(ctx context.Context) (net.Conn, error)
+
+	// PushHandler receives RESP3 push replies, such as client side caching
+	// invalidations, that arrive on connections used by Call. Push replies
+	// are discarded if it is nil.
+	PushHandler func(*Reply)
+
+	IdleTimeout  time.Duration // Close connections idle for longer, zero disables
+	MaxConnAge   time.Duration // Close connections older than this, zero disables
+	TestOnBorrow time.Duration // PING connections idle for longer before use, zero disables
+
+	once    sync.Once
+	initErr error
+	pool    chan *pooledConn
+	done    chan struct{}
+
+	mu        sync.Mutex
+	closed    bool
+	poolStats PoolStats
 }
 
 func (c *Client) inc(name string) {
@@ -41,72 +99,304 @@ func (c *Client) record(name string, value float64) {
 // Call is the canonical way of talking to Redis. It accepts any
 // Redis command and a arbitrary number of arguments.
 func (c *Client) Call(args ...interface{}) (reply *Reply, err error) {
+	return c.CallContext(context.Background(), args...)
+}
+
+// CallContext is like Call, but also gives up waiting for or opening a
+// connection, or waiting for the reply, once the context is done. The earlier
+// of the context deadline and the Client timeouts applies. A connection whose call was abandoned is closed
+// rather than reused since the reply may still arrive on it.
+func (c *Client) CallContext(ctx context.Context, args ...interface{}) (reply *Reply, err error) {
+	return c.call(ctx, c.readTimeout(), false, args)
+}
+
+// CallWithTimeout is for blocking commands like BLPOP, XREAD BLOCK or WAIT
+// which wait on the server for up to the given timeout. The reply is waited
+// for that long plus a margin, instead of the Client ReadTimeout. A zero
+// timeout, which makes the server wait indefinitely, waits for the reply
+// indefinitely too. The nil reply sent when the timeout expires is not counted
+// as an error in the Stats.
+func (c *Client) CallWithTimeout(timeout time.Duration, args ...interface{}) (*Reply, error) {
+	if timeout > 0 {
+		timeout += blockingMargin
+	}
+	return c.call(context.Background(), timeout, true, args)
+}
+
+func (c *Client) call(ctx context.Context, read time.Duration, blocking bool, args []interface{}) (reply *Reply, err error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 	start := time.Now()
-	conn, err := c.connect()
+	conn, err := c.connect(ctx)
 	c.record(
 		"redis connection acquire", float64(time.Since(start).Nanoseconds()))
-	defer func() {
-		c.record(
-			"redis connection release", float64(time.Since(start).Nanoseconds()))
-		if err != nil && c.shouldClose(err) {
-			c.inc("redis connection error close")
-			conn.Close()
-			conn = nil
-		}
-		c.pool <- conn
-	}()
 	if err != nil {
 		c.inc("redis connection accquire error")
 		return nil, err
 	}
-	err = conn.Sock().SetDeadline(start.Add(c.Timeout))
+	defer func() {
+		c.record(
+			"redis connection release", float64(time.Since(start).Nanoseconds()))
+		c.release(conn)
+	}()
+
+	err = c.setDeadlines(ctx, conn, read)
 	if err != nil {
 		c.inc("redis connection set deadline error")
 		return nil, err
 	}
+
+	if ctx.Done() != nil {
+		stop := c.watch(ctx, conn)
+		defer func() {
+			interrupted := stop()
+			if err != nil && (interrupted || expired(ctx)) {
+				c.inc("redis connection abandoned close")
+				c.discard(conn)
+				conn = nil
+				// the context may lag slightly behind its deadline
+				<-ctx.Done()
+				err = ctx.Err()
+			}
+		}()
+	}
+
 	err = conn.Write(args...)
 	c.record("redis connection write", float64(time.Since(start).Nanoseconds()))
 	if err != nil {
 		c.inc("redis connection write error")
 		return nil, err
 	}
-	reply, err = conn.Read()
+	reply, err = c.read(conn.connection)
 	c.record("redis connection read", float64(time.Since(start).Nanoseconds()))
-	if err != nil {
+	if blocking && err == ErrNilMultiBulk {
+		c.inc("redis connection blocking timeout")
+	} else if err != nil {
 		c.inc("redis connection read error")
 	}
 	return reply, err
 }
 
-// Pop a connection from the pool or create a fresh one.
-func (c *Client) connect() (conn Conn, err error) {
-	if c.pool == nil {
-		if c.PoolSize == 0 {
-			return nil, errPoolSizeNotSpecified
+// Interrupt any I/O on the connection once the context is done. The returned
+// function stops watching and reports if the I/O was interrupted.
+func (c *Client) watch(ctx context.Context, conn Conn) func() bool {
+	stop := make(chan struct{})
+	interrupted := make(chan bool, 1)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Sock().SetDeadline(time.Unix(1, 0))
+			interrupted <- true
+		case <-stop:
+			interrupted <- false
 		}
-		c.pool = make(chan Conn, c.PoolSize)
-		go func() {
-			var i uint
-			for i = 0; i < c.PoolSize; i++ {
-				c.pool <- nil
+	}()
+	return func() bool {
+		close(stop)
+		return <-interrupted
+	}
+}
+
+// Create a fresh connection outside of the pool.
+func (c *Client) dial(ctx context.Context) (*connection, error) {
+	if c.isClosed() {
+		return nil, ErrClientClosed
+	}
+	c.inc("redis connection new")
+	var conn *connection
+	var err error
+	switch {
+	case c.Dialer != nil:
+		conn, err = c.dialCustom(ctx)
+	default:
+		conn, err = c.dialNet(ctx)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err = c.setup(ctx, conn); err != nil {
+		c.inc("redis connection setup error")
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// Dial Addr using Proto, establishing TLS for TCP if configured.
+func (c *Client) dialNet(ctx context.Context) (*connection, error) {
+	dialer := &net.Dialer{Timeout: c.dialTimeout()}
+	var sock net.Conn
+	var err error
+	if c.useTLS() {
+		tlsDialer := &tls.Dialer{NetDialer: dialer, Config: c.TLSConfig}
+		sock, err = tlsDialer.DialContext(ctx, c.Proto, c.Addr)
+	} else {
+		sock, err = dialer.DialContext(ctx, c.Proto, c.Addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return newConnection(sock), nil
+}
+
+// Dial using the Dialer, establishing TLS on top if configured.
+func (c *Client) dialCustom(ctx context.Context) (*connection, error) {
+	if timeout := c.dialTimeout(); timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	sock, err := c.Dialer(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if c.useTLS() {
+		config := c.TLSConfig
+		if config.ServerName == "" {
+			config = config.Clone()
+			config.ServerName, _, _ = net.SplitHostPort(c.Addr)
+		}
+		tlsSock := tls.Client(sock, config)
+		if err = tlsSock.HandshakeContext(ctx); err != nil {
+			sock.Close()
+			return nil, err
+		}
+		sock = tlsSock
+	}
+	return newConnection(sock), nil
+}
+
+// TLS applies to every protocol but unix sockets.
+func (c *Client) useTLS() bool {
+	return c.TLSConfig != nil && !strings.HasPrefix(c.Proto, "unix")
+}
+
+// Prepare a fresh connection by switching to RESP3, authenticating, selecting
+// the database and setting the client name as configured. Gives up once the
+// context is done.
+func (c *Client) setup(ctx context.Context, conn *connection) (err error) {
+	var cmds [][]interface{}
+	if c.Protocol == 3 {
+		hello := []interface{}{"HELLO", 3}
+		if c.Password != "" {
+			user := c.Username
+			if user == "" {
+				user = "default"
+			}
+			hello = append(hello, "AUTH", user, c.Password)
+		}
+		if c.ClientName != "" {
+			hello = append(hello, "SETNAME", c.ClientName)
+		}
+		cmds = append(cmds, hello)
+	} else {
+		if c.Password != "" && c.Username != "" {
+			cmds = append(cmds, []interface{}{"AUTH", c.Username, c.Password})
+		} else if c.Password != "" {
+			cmds = append(cmds, []interface{}{"AUTH", c.Password})
+		}
+		if c.ClientName != "" {
+			cmds = append(cmds, []interface{}{"CLIENT", "SETNAME", c.ClientName})
+		}
+	}
+	if c.DB != 0 {
+		cmds = append(cmds, []interface{}{"SELECT", c.DB})
+	}
+	if len(cmds) == 0 {
+		return nil
+	}
+
+	if err = c.setDeadlines(ctx, conn, c.readTimeout()); err != nil {
+		return err
+	}
+	if ctx.Done() != nil {
+		stop := c.watch(ctx, conn)
+		defer func() {
+			interrupted := stop()
+			if err != nil && (interrupted || expired(ctx)) {
+				<-ctx.Done()
+				err = ctx.Err()
 			}
 		}()
 	}
-	conn = <-c.pool
-	if conn == nil {
-		c.inc("redis connection new")
-		conn, err = Dial(c.Addr, c.Proto, c.Timeout)
-		if err != nil {
-			return nil, err
+	if err = conn.WriteBatch(cmds); err != nil {
+		return err
+	}
+	for range cmds {
+		if _, err = conn.Read(); err != nil {
+			return err
 		}
 	}
-	return conn, err
+	// connections used for subscriptions block reading without a deadline
+	return conn.Sock().SetDeadline(time.Time{})
+}
+
+// Set the deadlines for sending a command now and reading its reply within
+// the given timeout, neither later than the context deadline.
+func (c *Client) setDeadlines(ctx context.Context, conn Conn, read time.Duration) error {
+	now := time.Now()
+	sock := conn.Sock()
+	if err := sock.SetWriteDeadline(deadline(ctx, now, c.writeTimeout())); err != nil {
+		return err
+	}
+	return sock.SetReadDeadline(deadline(ctx, now, read))
 }
 
-// Check if an error deserves closing the connection.
-func (c *Client) shouldClose(err error) bool {
-	if strings.HasSuffix(err.Error(), "broken pipe") {
+// Returns the deadline for the timeout starting at now, capped by the context
+// deadline. The zero time means no deadline.
+func deadline(ctx context.Context, now time.Time, timeout time.Duration) time.Time {
+	var d time.Time
+	if timeout > 0 {
+		d = now.Add(timeout)
+	}
+	if cd, ok := ctx.Deadline(); ok && (d.IsZero() || cd.Before(d)) {
+		d = cd
+	}
+	return d
+}
+
+// Check if the context is done or its deadline has passed.
+func expired(ctx context.Context) bool {
+	if ctx.Err() != nil {
 		return true
 	}
-	return false
+	d, ok := ctx.Deadline()
+	return ok && !time.Now().Before(d)
+}
+
+func (c *Client) dialTimeout() time.Duration {
+	if c.DialTimeout > 0 {
+		return c.DialTimeout
+	}
+	return c.Timeout
+}
+
+func (c *Client) readTimeout() time.Duration {
+	if c.ReadTimeout > 0 {
+		return c.ReadTimeout
+	}
+	return c.Timeout
+}
+
+func (c *Client) writeTimeout() time.Duration {
+	if c.WriteTimeout > 0 {
+		return c.WriteTimeout
+	}
+	return c.Timeout
+}
+
+// Read the reply to a command, passing along any push replies that come
+// before it.
+func (c *Client) read(conn *connection) (*Reply, error) {
+	for {
+		reply, err := conn.readReply()
+		if err != nil || reply.Kind != KindPush {
+			return reply, err
+		}
+		c.inc("redis connection push")
+		if c.PushHandler != nil {
+			c.PushHandler(reply)
+		}
+	}
 }
@@ -2,11 +2,28 @@ package redis_test
 
 import (
 	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"flag"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/daaku/go.redis"
 	"github.com/daaku/go.redis/redistest"
 )
 
@@ -39,6 +56,339 @@ func TestTimeout(t *testing.T) {
 	}
 }
 
+func TestReadTimeout(t *testing.T) {
+	server, client := redistest.NewServerClient(t)
+	defer server.Close()
+	client.Timeout = 50 * time.Millisecond
+	client.ReadTimeout = 2 * time.Second
+	if _, err := client.Call("BLPOP", "list", "0.2"); err != redis.ErrNilMultiBulk {
+		t.Fatalf("was expecting ErrNilMultiBulk but got: %v", err)
+	}
+
+	client.ReadTimeout = 20 * time.Millisecond
+	_, err := client.Call("BLPOP", "list", "1")
+	if err == nil || !strings.HasSuffix(err.Error(), "i/o timeout") {
+		t.Fatalf("was expecting timeout error but got: %v", err)
+	}
+}
+
+func TestCallWithTimeout(t *testing.T) {
+	server, _ := redistest.NewServerClient(t)
+	defer server.Close()
+	client, stats := newPoolClient(server)
+	defer client.Close()
+	client.Timeout = 50 * time.Millisecond
+	_, err := client.CallWithTimeout(200*time.Millisecond, "BLPOP", "list", "0.2")
+	if err != redis.ErrNilMultiBulk {
+		t.Fatalf("was expecting ErrNilMultiBulk but got: %v", err)
+	}
+	if n := stats.Count("redis connection read error"); n != 0 {
+		t.Fatalf("was expecting no read errors but got %d", n)
+	}
+	if n := stats.Count("redis connection blocking timeout"); n != 1 {
+		t.Fatalf("was expecting 1 blocking timeout but got %d", n)
+	}
+}
+
+func TestConnectionSetup(t *testing.T) {
+	node := newFakeNode(t)
+	defer node.Close()
+	node.Handle(func(cmd, prev []string) string {
+		if cmd[0] == "GET" {
+			return bulk(strings.Join(prev, ","))
+		}
+		return "+OK\r\n"
+	})
+	client := &redis.Client{
+		Proto:      "tcp",
+		Addr:       node.Addr(),
+		PoolSize:   1,
+		Timeout:    time.Second,
+		Username:   "app",
+		Password:   "secret",
+		DB:         2,
+		ClientName: "worker",
+	}
+	defer client.Close()
+	reply, err := client.Call("GET", "foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "AUTH app secret,CLIENT SETNAME worker,SELECT 2"
+	if got := reply.Elem.String(); got != expected {
+		t.Fatalf("was expecting %q but got %q", expected, got)
+	}
+}
+
+func TestConnectionSetupError(t *testing.T) {
+	node := newFakeNode(t)
+	defer node.Close()
+	node.Handle(func(cmd, prev []string) string {
+		if cmd[0] == "AUTH" {
+			return "-WRONGPASS invalid username-password pair\r\n"
+		}
+		return "+OK\r\n"
+	})
+	client := &redis.Client{
+		Proto:    "tcp",
+		Addr:     node.Addr(),
+		PoolSize: 1,
+		Timeout:  time.Second,
+		Password: "wrong",
+	}
+	defer client.Close()
+	_, err := client.Call("PING")
+	if !redis.IsRedisError(err) {
+		t.Fatalf("was expecting a redis error but got %v", err)
+	}
+	if stats := client.PoolStats(); stats.Total != 0 {
+		t.Fatalf("was expecting no open connections but got %+v", stats)
+	}
+}
+
+func TestConnectionSetupContext(t *testing.T) {
+	// accepts connections but never replies
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	client := &redis.Client{
+		Proto:      "tcp",
+		Addr:       l.Addr().String(),
+		PoolSize:   1,
+		Timeout:    10 * time.Second,
+		ClientName: "worker",
+	}
+	defer client.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := client.CallContext(ctx, "PING"); err != context.DeadlineExceeded {
+		t.Fatalf("was expecting context.DeadlineExceeded but got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("setup took %s despite the context", elapsed)
+	}
+
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	if _, err := client.CallContext(ctx, "PING"); err != context.Canceled {
+		t.Fatalf("was expecting context.Canceled but got %v", err)
+	}
+	if stats := client.PoolStats(); stats.Total != 0 {
+		t.Fatalf("was expecting no open connections but got %+v", stats)
+	}
+}
+
+// Flags live on the global flag set, so each run of a test needs fresh names.
+var flagRuns int32
+
+func flagName(prefix string) string {
+	return fmt.Sprintf("%s-%d", prefix, atomic.AddInt32(&flagRuns, 1))
+}
+
+func TestClientFlagPassword(t *testing.T) {
+	name := flagName("password-test")
+	client := redis.ClientFlag(name)
+	file := filepath.Join(t.TempDir(), "password")
+	if err := os.WriteFile(file, []byte("from-file\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := flag.Set(name+".password-file", file); err != nil {
+		t.Fatal(err)
+	}
+	if client.Password != "from-file" {
+		t.Fatalf("was expecting password from file but got %q", client.Password)
+	}
+	t.Setenv("TEST_REDIS_PASSWORD", "from-env")
+	if err := flag.Set(name+".password-env", "TEST_REDIS_PASSWORD"); err != nil {
+		t.Fatal(err)
+	}
+	if client.Password != "from-env" {
+		t.Fatalf("was expecting password from env but got %q", client.Password)
+	}
+	if err := flag.Set(name+".password-env", "TEST_REDIS_MISSING"); err == nil {
+		t.Fatal("was expecting an error for a missing environment variable")
+	}
+}
+
+// A self-signed certificate for 127.0.0.1, usable by both servers and
+// clients.
+func newCert(t *testing.T) (tls.Certificate, *x509.CertPool) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "redistest"},
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{
+			x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(leaf)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}, pool
+}
+
+// Terminate TLS in front of the server, requiring a client certificate.
+func tlsProxy(t *testing.T, addr string, cert tls.Certificate, pool *x509.CertPool) net.Listener {
+	l, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    pool,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				backend, err := net.Dial("tcp", addr)
+				if err != nil {
+					return
+				}
+				defer backend.Close()
+				go io.Copy(backend, conn)
+				io.Copy(conn, backend)
+			}()
+		}
+	}()
+	return l
+}
+
+func TestTLS(t *testing.T) {
+	server, _ := redistest.NewServerClient(t)
+	defer server.Close()
+	cert, pool := newCert(t)
+	proxy := tlsProxy(t, server.Addr(), cert, pool)
+	defer proxy.Close()
+
+	client := &redis.Client{
+		Proto:    "tcp",
+		Addr:     proxy.Addr().String(),
+		PoolSize: 1,
+		Timeout:  time.Second,
+		TLSConfig: &tls.Config{
+			Certificates: []tls.Certificate{cert},
+			RootCAs:      pool,
+		},
+	}
+	defer client.Close()
+	if _, err := client.Call("SET", "foo", "bar"); err != nil {
+		t.Fatal(err)
+	}
+	if value, err := client.Get("foo"); err != nil || string(value) != "bar" {
+		t.Fatalf("was expecting bar but got %q %v", value, err)
+	}
+
+	untrusted := &redis.Client{
+		Proto:     "tcp",
+		Addr:      proxy.Addr().String(),
+		PoolSize:  1,
+		Timeout:   time.Second,
+		TLSConfig: &tls.Config{Certificates: []tls.Certificate{cert}},
+	}
+	defer untrusted.Close()
+	if _, err := untrusted.Call("PING"); err == nil {
+		t.Fatal("was expecting a certificate verification error")
+	}
+}
+
+func TestTLSProto(t *testing.T) {
+	server, _ := redistest.NewServerClient(t)
+	defer server.Close()
+	cert, pool := newCert(t)
+	proxy := tlsProxy(t, server.Addr(), cert, pool)
+	defer proxy.Close()
+
+	client := &redis.Client{
+		Proto:    "tcp4",
+		Addr:     proxy.Addr().String(),
+		PoolSize: 1,
+		Timeout:  time.Second,
+		TLSConfig: &tls.Config{
+			Certificates: []tls.Certificate{cert},
+			RootCAs:      pool,
+		},
+	}
+	defer client.Close()
+	if _, err := client.Call("PING"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDialer(t *testing.T) {
+	server, _ := redistest.NewServerClient(t)
+	defer server.Close()
+	var dials int
+	var hasDeadline bool
+	client := &redis.Client{
+		Addr:     "unused",
+		PoolSize: 1,
+		Timeout:  time.Second,
+		Dialer: func(ctx context.Context) (net.Conn, error) {
+			dials++
+			_, hasDeadline = ctx.Deadline()
+			var d net.Dialer
+			return d.DialContext(ctx, "tcp", server.Addr())
+		},
+	}
+	defer client.Close()
+	for i := 0; i < 2; i++ {
+		if _, err := client.Call("PING"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if dials != 1 || !hasDeadline {
+		t.Fatalf("was expecting one dial with a deadline but got %d %v", dials, hasDeadline)
+	}
+}
+
+func TestDialerTLS(t *testing.T) {
+	server, _ := redistest.NewServerClient(t)
+	defer server.Close()
+	cert, pool := newCert(t)
+	proxy := tlsProxy(t, server.Addr(), cert, pool)
+	defer proxy.Close()
+	client := &redis.Client{
+		Addr:     proxy.Addr().String(),
+		PoolSize: 1,
+		Timeout:  time.Second,
+		TLSConfig: &tls.Config{
+			Certificates: []tls.Certificate{cert},
+			RootCAs:      pool,
+		},
+		Dialer: func(ctx context.Context) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "tcp", proxy.Addr().String())
+		},
+	}
+	defer client.Close()
+	if _, err := client.Call("PING"); err != nil {
+		t.Fatal(err)
+	}
+}
+
 func BenchmarkItoa(b *testing.B) {
 	for i := 0; i < b.N; i++ {
 		strconv.Itoa(i)
@@ -84,3 +434,124 @@ func BenchmarkAppendBuffer(b *testing.B) {
 		buf.WriteByte('\r')
 	}
 }
+
+func TestProtocol3(t *testing.T) {
+	server, client := redistest.NewServerClient(t)
+	defer server.Close()
+	client = &redis.Client{
+		Proto:    client.Proto,
+		Addr:     client.Addr,
+		PoolSize: 1,
+		Timeout:  time.Second,
+		Protocol: 3,
+	}
+	if _, err := client.Call("HSET", "foo", "bar", "baz"); err != nil {
+		t.Fatal(err)
+	}
+	reply, err := client.Call("HGETALL", "foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reply.Kind != redis.KindMap {
+		t.Fatalf("was expecting a map but got %c", reply.Kind)
+	}
+	if v := reply.Map()["bar"]; v == nil || v.Elem.String() != "baz" {
+		t.Fatalf("unexpected reply %+v", reply)
+	}
+}
+
+func TestCallContextCancel(t *testing.T) {
+	server, client := redistest.NewServerClient(t)
+	defer server.Close()
+	client = &redis.Client{
+		Proto:    client.Proto,
+		Addr:     client.Addr,
+		PoolSize: 1,
+		Timeout:  time.Second,
+	}
+	defer client.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := client.CallContext(ctx, "BLPOP", "list", 0)
+	if err != context.DeadlineExceeded {
+		t.Fatalf("was expecting context.DeadlineExceeded but got %v", err)
+	}
+	if _, err := client.Call("RPUSH", "list", "foo"); err != nil {
+		t.Fatal(err)
+	}
+	reply, err := client.Call("GET", "bar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reply.Nil() {
+		t.Fatalf("was expecting nil reply but got %+v", reply)
+	}
+	if stats := client.PoolStats(); stats.Total != 1 || stats.InUse != 0 {
+		t.Fatalf("was expecting one idle connection but got %+v", stats)
+	}
+}
+
+func TestCallContextCanceled(t *testing.T) {
+	node := newFakeNode(t)
+	defer node.Close()
+	var mu sync.Mutex
+	pings := 0
+	node.Handle(func(cmd, prev []string) string {
+		mu.Lock()
+		defer mu.Unlock()
+		pings++
+		return "+PONG\r\n"
+	})
+	client := &redis.Client{
+		Proto:    "tcp",
+		Addr:     node.Addr(),
+		PoolSize: 1,
+		Timeout:  time.Second,
+	}
+	defer client.Close()
+	if _, err := client.Call("PING"); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	for i := 0; i < 3; i++ {
+		if _, err := client.CallContext(ctx, "PING"); err != context.Canceled {
+			t.Fatalf("was expecting context.Canceled but got %v", err)
+		}
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if pings != 1 {
+		t.Fatalf("was expecting a single PING to reach the server but got %d", pings)
+	}
+	if stats := client.PoolStats(); stats.Total != 1 || stats.InUse != 0 {
+		t.Fatalf("was expecting the connection to be kept but got %+v", stats)
+	}
+}
+
+func TestCallContextPoolWait(t *testing.T) {
+	server, client := redistest.NewServerClient(t)
+	defer server.Close()
+	client = &redis.Client{
+		Proto:    client.Proto,
+		Addr:     client.Addr,
+		PoolSize: 1,
+		Timeout:  time.Second,
+	}
+	_, err := client.Transaction(func(tx *redis.Tx) error {
+		ctx, cancel := context.WithTimeout(
+			context.Background(), 10*time.Millisecond)
+		defer cancel()
+		_, err := client.CallContext(ctx, "PING")
+		if err != context.DeadlineExceeded {
+			t.Fatalf("was expecting context.DeadlineExceeded but got %v", err)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Call("PING"); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,476 @@
+package redis
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// Number of hash slots in a Redis Cluster.
+	clusterSlots = 16384
+
+	// Maximum number of MOVED or ASK redirects followed for a single call.
+	clusterMaxRedirects = 16
+
+	// Minimum time between refreshes caused by connection errors.
+	clusterRefreshInterval = 100 * time.Millisecond
+)
+
+var (
+	// ErrClusterDown is returned when the cluster topology could not be
+	// loaded from any of the known nodes.
+	ErrClusterDown = errors.New("go.redis: no cluster node could be reached")
+
+	// ErrTooManyRedirects is returned when a call keeps getting redirected.
+	ErrTooManyRedirects = errors.New("go.redis: too many cluster redirects")
+)
+
+// Commands which do not operate on keys and may be sent to any node.
+var clusterKeyless = map[string]bool{
+	"AUTH":      true,
+	"CLIENT":    true,
+	"CLUSTER":   true,
+	"COMMAND":   true,
+	"CONFIG":    true,
+	"DBSIZE":    true,
+	"ECHO":      true,
+	"FLUSHALL":  true,
+	"FLUSHDB":   true,
+	"FUNCTION":  true,
+	"INFO":      true,
+	"KEYS":      true,
+	"LASTSAVE":  true,
+	"PING":      true,
+	"PUBLISH":   true,
+	"PUBSUB":    true,
+	"RANDOMKEY": true,
+	"ROLE":      true,
+	"SCAN":      true,
+	"SCRIPT":    true,
+	"TIME":      true,
+	"WAIT":      true,
+}
+
+// ClusterClient talks to a Redis Cluster. It routes each command to the node
+// serving the hash slot of its key, keeping a Client with its own connection
+// pool per node, and follows MOVED and ASK redirects.
+type ClusterClient struct {
+	Addrs    []string      // Seed node addresses like "127.0.0.1:7000"
+	PoolSize uint          // Connection Pool Size per node, must be specified
+	Timeout  time.Duration // Timeout per call
+	Stats    Stats         // For Stats collection
+	Protocol int           // Protocol version, 3 sends HELLO 3 on connect
+
+	Username   string // ACL user to authenticate as, instead of the default user
+	Password   string // Password to authenticate new connections with
+	ClientName string // Name to set on new connections
+
+	// TLSConfig enables TLS for the connections to the nodes.
+	TLSConfig *tls.Config
+
+	// Dialer opens the connections to the nodes instead of dialing their
+	// address using TCP. The context expires after the timeout.
+	Dialer func(ctx context.Context, addr string) (net.Conn, error)
+
+	mu         sync.Mutex
+	slots      []string // node address by slot, nil until loaded
+	clients    map[string]*Client
+	refreshing bool
+	refreshed  time.Time // when the last refresh started
+}
+
+func (c *ClusterClient) inc(name string) {
+	if c.Stats != nil {
+		c.Stats.Inc(name)
+	}
+}
+
+// Call routes the command to the right node. It accepts any Redis command and
+// a arbitrary number of arguments.
+func (c *ClusterClient) Call(args ...interface{}) (*Reply, error) {
+	return c.CallContext(context.Background(), args...)
+}
+
+// CallContext is like Call, but honors the context the same way
+// Client.CallContext does. If the node can't be reached or the connection
+// breaks, as happens when it fails, the slot assignments are refreshed and the
+// call is retried once if the slot moved to another node.
+func (c *ClusterClient) CallContext(ctx context.Context, args ...interface{}) (*Reply, error) {
+	addr, err := c.route(args)
+	if err != nil {
+		return nil, err
+	}
+	asking := false
+	retried := false
+	for i := 0; i < clusterMaxRedirects; i++ {
+		client := c.client(addr)
+		var reply *Reply
+		if asking {
+			reply, err = c.asking(ctx, client, args)
+		} else {
+			reply, err = client.CallContext(ctx, args...)
+		}
+		if err == nil {
+			return reply, nil
+		}
+		kind, slot, target, ok := parseRedirect(err)
+		if !ok {
+			if retried || ctx.Err() != nil || !isConnError(err) {
+				return reply, err
+			}
+			c.inc("redis cluster connection error")
+			retried = true
+			c.refreshAfterError()
+			next, rerr := c.route(args)
+			if rerr != nil || next == addr {
+				return reply, err
+			}
+			addr = next
+			asking = false
+			continue
+		}
+		switch kind {
+		case "MOVED":
+			c.inc("redis cluster moved")
+			c.move(slot, target)
+			asking = false
+		case "ASK":
+			c.inc("redis cluster ask")
+			asking = true
+		}
+		addr = target
+	}
+	return nil, ErrTooManyRedirects
+}
+
+// Send the command preceded by ASKING on the same connection.
+func (c *ClusterClient) asking(ctx context.Context, client *Client, args []interface{}) (*Reply, error) {
+	replies, err := client.exec(ctx, [][]interface{}{{"ASKING"}, args})
+	if err != nil {
+		return nil, err
+	}
+	return replies[1], replies[1].Err
+}
+
+// Refresh reloads the slot assignments using CLUSTER SLOTS, or CLUSTER SHARDS
+// if the former isn't available, asking each known node in turn until one
+// answers.
+func (c *ClusterClient) Refresh() error {
+	c.mu.Lock()
+	addrs := make([]string, 0, len(c.Addrs)+len(c.clients))
+	addrs = append(addrs, c.Addrs...)
+	for addr := range c.clients {
+		addrs = append(addrs, addr)
+	}
+	c.refreshed = time.Now()
+	c.mu.Unlock()
+
+	c.inc("redis cluster refresh")
+	for _, addr := range addrs {
+		slots, err := c.load(addr)
+		if err != nil {
+			c.inc("redis cluster refresh error")
+			continue
+		}
+		c.mu.Lock()
+		c.slots = slots
+		c.mu.Unlock()
+		return nil
+	}
+	return ErrClusterDown
+}
+
+// Close the clients for all the nodes.
+func (c *ClusterClient) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, client := range c.clients {
+		client.Close()
+	}
+	return nil
+}
+
+// Load the slot assignments from the given node.
+func (c *ClusterClient) load(addr string) ([]string, error) {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	client := c.client(addr)
+	reply, err := client.Call("CLUSTER", "SLOTS")
+	if err == nil {
+		return parseClusterSlots(reply, host)
+	}
+	reply, serr := client.Call("CLUSTER", "SHARDS")
+	if serr == nil {
+		return parseClusterShards(reply, host)
+	}
+	return nil, err
+}
+
+// Returns the node address for the key of the command, loading the slot
+// assignments if necessary.
+func (c *ClusterClient) route(args []interface{}) (string, error) {
+	c.mu.Lock()
+	loaded := c.slots != nil
+	c.mu.Unlock()
+	if !loaded {
+		if err := c.Refresh(); err != nil {
+			return "", err
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	slot := rand.Intn(clusterSlots)
+	if key, ok := clusterKey(args); ok {
+		slot = Slot(key)
+	}
+	if addr := c.slots[slot]; addr != "" {
+		return addr, nil
+	}
+	// the slot is not served, let the seed node redirect us
+	if len(c.Addrs) == 0 {
+		return "", ErrClusterDown
+	}
+	return c.Addrs[0], nil
+}
+
+// Record a MOVED redirect, and refresh the slot assignments in the background
+// since more slots have likely moved.
+func (c *ClusterClient) move(slot int, addr string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.slots != nil && slot >= 0 && slot < clusterSlots {
+		c.slots[slot] = addr
+	}
+	if c.refreshing {
+		return
+	}
+	c.refreshing = true
+	go func() {
+		c.Refresh()
+		c.mu.Lock()
+		c.refreshing = false
+		c.mu.Unlock()
+	}()
+}
+
+// Refresh the slot assignments after a connection error, unless a refresh is
+// already in progress or started recently.
+func (c *ClusterClient) refreshAfterError() {
+	c.mu.Lock()
+	if c.refreshing || time.Since(c.refreshed) < clusterRefreshInterval {
+		c.mu.Unlock()
+		return
+	}
+	c.refreshing = true
+	c.mu.Unlock()
+	c.Refresh()
+	c.mu.Lock()
+	c.refreshing = false
+	c.mu.Unlock()
+}
+
+// Check if the error means the node could not be reached or the connection
+// broke, rather than being an error sent by the node.
+func isConnError(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) || err == io.EOF || err == io.ErrUnexpectedEOF
+}
+
+// Returns the Client for the node, creating it if necessary.
+func (c *ClusterClient) client(addr string) *Client {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if client, ok := c.clients[addr]; ok {
+		return client
+	}
+	if c.clients == nil {
+		c.clients = make(map[string]*Client)
+	}
+	client := &Client{
+		Addr:       addr,
+		Proto:      "tcp",
+		PoolSize:   c.PoolSize,
+		Timeout:    c.Timeout,
+		Stats:      c.Stats,
+		Protocol:   c.Protocol,
+		Username:   c.Username,
+		Password:   c.Password,
+		ClientName: c.ClientName,
+		TLSConfig:  c.TLSConfig,
+	}
+	if dialer := c.Dialer; dialer != nil {
+		client.Dialer = func(ctx context.Context) (net.Conn, error) {
+			return dialer(ctx, addr)
+		}
+	}
+	c.clients[addr] = client
+	return client
+}
+
+// Parse a "MOVED 3999 127.0.0.1:6381" or "ASK 3999 127.0.0.1:6381" error.
+func parseRedirect(err error) (kind string, slot int, addr string, ok bool) {
+	if !IsMoved(err) && !IsAsk(err) {
+		return "", 0, "", false
+	}
+	var e *RedisError
+	errors.As(err, &e)
+	parts := strings.Fields(e.Message)
+	if len(parts) != 2 {
+		return "", 0, "", false
+	}
+	slot, serr := strconv.Atoi(parts[0])
+	if serr != nil {
+		return "", 0, "", false
+	}
+	return e.Code, slot, parts[1], true
+}
+
+// Parse the reply to CLUSTER SLOTS, which is an array of slot ranges each
+// holding the first slot, the last slot, the master as an array of ip, port
+// and id, and then the replicas the same way.
+func parseClusterSlots(reply *Reply, host string) ([]string, error) {
+	slots := make([]string, clusterSlots)
+	for _, r := range reply.Elems {
+		if len(r.Elems) < 3 || len(r.Elems[2].Elems) < 2 {
+			return nil, ErrProtocol
+		}
+		node := r.Elems[2]
+		addr := nodeAddr(node.Elems[0].Elem.String(), node.Elems[1].Elem.String(), host)
+		if err := assignSlots(slots, r.Elems[0].Elem, r.Elems[1].Elem, addr); err != nil {
+			return nil, err
+		}
+	}
+	return slots, nil
+}
+
+// Parse the reply to CLUSTER SHARDS, which is an array of maps with "slots"
+// holding pairs of slot range boundaries and "nodes" holding a map per node.
+func parseClusterShards(reply *Reply, host string) ([]string, error) {
+	slots := make([]string, clusterSlots)
+	for _, r := range reply.Elems {
+		shard := r.Map()
+		ranges, nodes := shard["slots"], shard["nodes"]
+		if ranges == nil || nodes == nil || ranges.Len()%2 == 1 {
+			return nil, ErrProtocol
+		}
+		var addr string
+		for _, n := range nodes.Elems {
+			node := n.Map()
+			role, ip, port := node["role"], node["ip"], node["port"]
+			if role == nil || ip == nil || port == nil {
+				return nil, ErrProtocol
+			}
+			if role.Elem.String() == "master" {
+				addr = nodeAddr(ip.Elem.String(), port.Elem.String(), host)
+			}
+		}
+		if addr == "" {
+			continue
+		}
+		for i := 0; i < ranges.Len(); i += 2 {
+			err := assignSlots(slots, ranges.Elems[i].Elem, ranges.Elems[i+1].Elem, addr)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return slots, nil
+}
+
+// An empty ip means the node we asked.
+func nodeAddr(ip, port, host string) string {
+	if ip == "" || ip == "?" {
+		ip = host
+	}
+	return net.JoinHostPort(ip, port)
+}
+
+func assignSlots(slots []string, start, end Elem, addr string) error {
+	s, serr := strconv.Atoi(start.String())
+	e, eerr := strconv.Atoi(end.String())
+	if serr != nil || eerr != nil || s < 0 || e >= clusterSlots || s > e {
+		return ErrProtocol
+	}
+	for i := s; i <= e; i++ {
+		slots[i] = addr
+	}
+	return nil
+}
+
+// Returns the key of a command, if it has one. This is the first argument for
+// most commands.
+func clusterKey(args []interface{}) (string, bool) {
+	if len(args) < 2 {
+		return "", false
+	}
+	cmd := strings.ToUpper(argString(args[0]))
+	if clusterKeyless[cmd] {
+		return "", false
+	}
+	switch cmd {
+	case "EVAL", "EVALSHA", "EVAL_RO", "EVALSHA_RO", "FCALL", "FCALL_RO":
+		if len(args) < 4 || argString(args[2]) == "0" {
+			return "", false
+		}
+		return argString(args[3]), true
+	case "XREAD", "XREADGROUP":
+		for i := 1; i < len(args)-1; i++ {
+			if strings.ToUpper(argString(args[i])) == "STREAMS" {
+				return argString(args[i+1]), true
+			}
+		}
+		return "", false
+	}
+	return argString(args[1]), true
+}
+
+// Returns an argument as it will be sent to the server.
+func argString(arg interface{}) string {
+	switch v := arg.(type) {
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	}
+	b, _ := appendArg(nil, arg)
+	return string(b)
+}
+
+// Slot returns the cluster hash slot for the key. If the key contains a
+// non-empty {hashtag} only the hashtag is hashed, which allows keys to be
+// forced into the same slot.
+func Slot(key string) int {
+	if s := strings.IndexByte(key, '{'); s >= 0 {
+		if e := strings.IndexByte(key[s+1:], '}'); e > 0 {
+			key = key[s+1 : s+1+e]
+		}
+	}
+	return int(crc16(key) % clusterSlots)
+}
+
+// CRC16 using the XMODEM polynomial as specified by Redis Cluster.
+func crc16(s string) uint16 {
+	var crc uint16
+	for i := 0; i < len(s); i++ {
+		crc ^= uint16(s[i]) << 8
+		for j := 0; j < 8; j++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
@@ -0,0 +1,294 @@
+package redis_test
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/daaku/go.redis"
+	"github.com/daaku/go.redis/redistest"
+)
+
+// CLUSTER SLOTS reply assigning all slots to the given address.
+func allSlots(addr string) string {
+	host, port, _ := net.SplitHostPort(addr)
+	return fmt.Sprintf("*1\r\n*3\r\n:0\r\n:16383\r\n*2\r\n$%d\r\n%s\r\n:%s\r\n",
+		len(host), host, port)
+}
+
+func newClusterClient(addrs ...string) *redis.ClusterClient {
+	return &redis.ClusterClient{
+		Addrs:    addrs,
+		PoolSize: 2,
+		Timeout:  time.Second,
+	}
+}
+
+func TestSlot(t *testing.T) {
+	cases := map[string]int{
+		"123456789": 12739,
+		"foo":       12182,
+	}
+	for key, expected := range cases {
+		if actual := redis.Slot(key); actual != expected {
+			t.Errorf("slot for %s expected %d got %d", key, expected, actual)
+		}
+	}
+	if redis.Slot("{user1000}.following") != redis.Slot("user1000") {
+		t.Error("was expecting the hashtag to be used")
+	}
+	if redis.Slot("foo{{bar}}zap") != redis.Slot("{bar") {
+		t.Error("was expecting the first hashtag to be used")
+	}
+	if redis.Slot("foo{}{bar}") == redis.Slot("bar") {
+		t.Error("was not expecting an empty hashtag to be used")
+	}
+}
+
+func TestClusterClient(t *testing.T) {
+	server, _ := redistest.NewServerClient(t)
+	defer server.Close()
+	client := newClusterClient(server.Addr())
+	if _, err := client.Call("SET", "foo", "bar"); err != nil {
+		t.Fatal(err)
+	}
+	reply, err := client.Call("GET", "foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reply.Elem.String() != "bar" {
+		t.Fatalf("was expecting bar but got %s", reply.Elem)
+	}
+}
+
+func TestClusterMoved(t *testing.T) {
+	a, b := newFakeNode(t), newFakeNode(t)
+	defer a.Close()
+	defer b.Close()
+	var mu sync.Mutex
+	moved := false
+	a.Handle(func(cmd, prev []string) string {
+		mu.Lock()
+		defer mu.Unlock()
+		if cmd[0] == "CLUSTER" {
+			if moved {
+				return allSlots(b.Addr())
+			}
+			return allSlots(a.Addr())
+		}
+		moved = true
+		return fmt.Sprintf("-MOVED %d %s\r\n", redis.Slot(cmd[1]), b.Addr())
+	})
+	b.Handle(func(cmd, prev []string) string {
+		if cmd[0] == "CLUSTER" {
+			return allSlots(b.Addr())
+		}
+		return "$3\r\nbar\r\n"
+	})
+
+	client := newClusterClient(a.Addr())
+	for i := 0; i < 2; i++ {
+		reply, err := client.Call("GET", "foo")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if reply.Elem.String() != "bar" {
+			t.Fatalf("was expecting bar but got %s", reply.Elem)
+		}
+	}
+}
+
+func TestClusterAsk(t *testing.T) {
+	a, b := newFakeNode(t), newFakeNode(t)
+	defer a.Close()
+	defer b.Close()
+	a.Handle(func(cmd, prev []string) string {
+		if cmd[0] == "CLUSTER" {
+			return allSlots(a.Addr())
+		}
+		return fmt.Sprintf("-ASK %d %s\r\n", redis.Slot(cmd[1]), b.Addr())
+	})
+	b.Handle(func(cmd, prev []string) string {
+		switch {
+		case cmd[0] == "ASKING":
+			return "+OK\r\n"
+		case len(prev) > 0 && prev[len(prev)-1] == "ASKING":
+			return "$3\r\nbar\r\n"
+		}
+		return fmt.Sprintf("-MOVED %d %s\r\n", redis.Slot(cmd[1]), a.Addr())
+	})
+
+	client := newClusterClient(a.Addr())
+	reply, err := client.Call("GET", "foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reply.Elem.String() != "bar" {
+		t.Fatalf("was expecting bar but got %s", reply.Elem)
+	}
+}
+
+func TestClusterFailover(t *testing.T) {
+	a, b := newFakeNode(t), newFakeNode(t)
+	defer a.Close()
+	defer b.Close()
+	a.Handle(func(cmd, prev []string) string {
+		if cmd[0] == "CLUSTER" {
+			return allSlots(a.Addr())
+		}
+		return "$1\r\na\r\n"
+	})
+	var mu sync.Mutex
+	failed := false
+	b.Handle(func(cmd, prev []string) string {
+		mu.Lock()
+		defer mu.Unlock()
+		if cmd[0] != "CLUSTER" {
+			return "$1\r\nb\r\n"
+		}
+		if failed {
+			return allSlots(b.Addr())
+		}
+		return allSlots(a.Addr())
+	})
+
+	client := newClusterClient(a.Addr(), b.Addr())
+	defer client.Close()
+	reply, err := client.Call("GET", "foo")
+	if err != nil || reply.Elem.String() != "a" {
+		t.Fatalf("was expecting a but got %v %v", reply, err)
+	}
+
+	// b takes over the slots of a, which can no longer be reached
+	mu.Lock()
+	failed = true
+	mu.Unlock()
+	a.Close()
+	time.Sleep(150 * time.Millisecond)
+	for i := 0; i < 2; i++ {
+		reply, err = client.Call("GET", "foo")
+		if err != nil || reply.Elem.String() != "b" {
+			t.Fatalf("was expecting b but got %v %v", reply, err)
+		}
+	}
+}
+
+func TestClusterNodeSettings(t *testing.T) {
+	a := newFakeNode(t)
+	defer a.Close()
+	a.Handle(func(cmd, prev []string) string {
+		if cmd[0] != "AUTH" && (len(prev) == 0 || prev[0] != "AUTH app secret") {
+			return "-NOAUTH Authentication required.\r\n"
+		}
+		switch cmd[0] {
+		case "CLUSTER":
+			return allSlots(a.Addr())
+		case "GET":
+			return bulk(prev[1])
+		}
+		return "+OK\r\n"
+	})
+	var mu sync.Mutex
+	var dialed []string
+	client := newClusterClient(a.Addr())
+	client.Username = "app"
+	client.Password = "secret"
+	client.ClientName = "worker"
+	client.Dialer = func(ctx context.Context, addr string) (net.Conn, error) {
+		mu.Lock()
+		dialed = append(dialed, addr)
+		mu.Unlock()
+		var d net.Dialer
+		return d.DialContext(ctx, "tcp", addr)
+	}
+	defer client.Close()
+	reply, err := client.Call("GET", "foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reply.Elem.String() != "CLIENT SETNAME worker" {
+		t.Fatalf("unexpected setup %q", reply.Elem)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(dialed) == 0 || dialed[0] != a.Addr() {
+		t.Fatalf("was expecting the dialer to be used but got %q", dialed)
+	}
+}
+
+func TestClusterTLS(t *testing.T) {
+	a := newFakeNode(t)
+	defer a.Close()
+	cert, pool := newCert(t)
+	proxy := tlsProxy(t, a.Addr(), cert, pool)
+	defer proxy.Close()
+	a.Handle(func(cmd, prev []string) string {
+		if cmd[0] == "CLUSTER" {
+			return allSlots(proxy.Addr().String())
+		}
+		return "$3\r\nbar\r\n"
+	})
+	client := newClusterClient(proxy.Addr().String())
+	client.TLSConfig = &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		RootCAs:      pool,
+	}
+	defer client.Close()
+	reply, err := client.Call("GET", "foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reply.Elem.String() != "bar" {
+		t.Fatalf("was expecting bar but got %s", reply.Elem)
+	}
+}
+
+func TestClusterAskContext(t *testing.T) {
+	a, b := newFakeNode(t), newFakeNode(t)
+	defer a.Close()
+	defer b.Close()
+	a.Handle(func(cmd, prev []string) string {
+		if cmd[0] == "CLUSTER" {
+			return allSlots(a.Addr())
+		}
+		return fmt.Sprintf("-ASK %d %s\r\n", redis.Slot(cmd[1]), b.Addr())
+	})
+	b.Handle(func(cmd, prev []string) string {
+		if cmd[0] == "ASKING" {
+			return "+OK\r\n"
+		}
+		return "" // never reply
+	})
+
+	client := newClusterClient(a.Addr())
+	client.Timeout = 10 * time.Second
+	defer client.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := client.CallContext(ctx, "GET", "foo"); err != context.DeadlineExceeded {
+		t.Fatalf("was expecting context.DeadlineExceeded but got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("the call took %s despite the context", elapsed)
+	}
+}
+
+func TestClusterTooManyRedirects(t *testing.T) {
+	a := newFakeNode(t)
+	defer a.Close()
+	a.Handle(func(cmd, prev []string) string {
+		if cmd[0] == "CLUSTER" {
+			return allSlots(a.Addr())
+		}
+		return fmt.Sprintf("-MOVED %d %s\r\n", redis.Slot(cmd[1]), a.Addr())
+	})
+	client := newClusterClient(a.Addr())
+	if _, err := client.Call("GET", "foo"); err != redis.ErrTooManyRedirects {
+		t.Fatalf("was expecting ErrTooManyRedirects but got %v", err)
+	}
+}
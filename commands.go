@@ -0,0 +1,367 @@
+package redis
+
+import (
+	"errors"
+	"strconv"
+	"time"
+)
+
+var (
+	// ErrNil is returned by the typed commands when the key does not exist.
+	ErrNil = errors.New("go.redis: nil reply")
+
+	// ErrUnexpectedReply is returned by the typed commands when the reply is
+	// not of the expected type.
+	ErrUnexpectedReply = errors.New("go.redis: unexpected reply type")
+)
+
+// SetOptions are the optional arguments for Set.
+type SetOptions struct {
+	Expiration time.Duration // Expire after the given duration, with millisecond precision
+	KeepTTL    bool          // Retain the existing time to live
+	NX         bool          // Only set the key if it does not already exist
+	XX         bool          // Only set the key if it already exists
+}
+
+// Z is a member of a sorted set along with its score.
+type Z struct {
+	Member string
+	Score  float64
+}
+
+// Get returns the value of a key, or ErrNil if it does not exist.
+func (c *Client) Get(key string) ([]byte, error) {
+	return bytesReply(c.Call("GET", key))
+}
+
+// MGet returns the values of the keys, with nil for the missing ones.
+func (c *Client) MGet(keys ...string) ([][]byte, error) {
+	args := make([]interface{}, 0, len(keys)+1)
+	args = append(args, "MGET")
+	for _, k := range keys {
+		args = append(args, k)
+	}
+	r, err := arrayReply(c.Call(args...))
+	if err != nil {
+		return nil, err
+	}
+	return r.BytesArray(), nil
+}
+
+// Set the value of a key. It returns false if the key was not set because of
+// the NX or XX options.
+func (c *Client) Set(key string, value interface{}, opt *SetOptions) (bool, error) {
+	args := []interface{}{"SET", key, value}
+	if opt != nil {
+		if opt.Expiration != 0 {
+			args = append(args, "PX", int64(opt.Expiration/time.Millisecond))
+		}
+		if opt.KeepTTL {
+			args = append(args, "KEEPTTL")
+		}
+		if opt.NX {
+			args = append(args, "NX")
+		}
+		if opt.XX {
+			args = append(args, "XX")
+		}
+	}
+	err := statusReply(c.Call(args...))
+	if err == ErrNil {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Del removes the keys and returns the number of keys that were removed.
+func (c *Client) Del(keys ...string) (int64, error) {
+	args := make([]interface{}, 0, len(keys)+1)
+	args = append(args, "DEL")
+	for _, k := range keys {
+		args = append(args, k)
+	}
+	return intReply(c.Call(args...))
+}
+
+// Exists returns true if the key exists.
+func (c *Client) Exists(key string) (bool, error) {
+	return boolReply(c.Call("EXISTS", key))
+}
+
+// Incr increments the number stored at key by one and returns the new value.
+func (c *Client) Incr(key string) (int64, error) {
+	return intReply(c.Call("INCR", key))
+}
+
+// IncrBy increments the number stored at key and returns the new value.
+func (c *Client) IncrBy(key string, value int64) (int64, error) {
+	return intReply(c.Call("INCRBY", key, value))
+}
+
+// Expire sets a timeout on key, with millisecond precision. It returns false
+// if the key does not exist.
+func (c *Client) Expire(key string, d time.Duration) (bool, error) {
+	return boolReply(c.Call("PEXPIRE", key, int64(d/time.Millisecond)))
+}
+
+// HGet returns the value of a hash field, or ErrNil if it does not exist.
+func (c *Client) HGet(key, field string) ([]byte, error) {
+	return bytesReply(c.Call("HGET", key, field))
+}
+
+// HSet sets a hash field and returns true if the field is new.
+func (c *Client) HSet(key, field string, value interface{}) (bool, error) {
+	return boolReply(c.Call("HSET", key, field, value))
+}
+
+// HDel removes hash fields and returns the number of fields that were removed.
+func (c *Client) HDel(key string, fields ...string) (int64, error) {
+	args := make([]interface{}, 0, len(fields)+2)
+	args = append(args, "HDEL", key)
+	for _, f := range fields {
+		args = append(args, f)
+	}
+	return intReply(c.Call(args...))
+}
+
+// HGetAll returns all the fields and values of a hash.
+func (c *Client) HGetAll(key string) (map[string]string, error) {
+	r, err := arrayReply(c.Call("HGETALL", key))
+	if err != nil {
+		return nil, err
+	}
+	return r.StringMapE()
+}
+
+// LPush prepends values to a list and returns its new length.
+func (c *Client) LPush(key string, values ...interface{}) (int64, error) {
+	return intReply(c.Call(append([]interface{}{"LPUSH", key}, values...)...))
+}
+
+// RPush appends values to a list and returns its new length.
+func (c *Client) RPush(key string, values ...interface{}) (int64, error) {
+	return intReply(c.Call(append([]interface{}{"RPUSH", key}, values...)...))
+}
+
+// LRange returns the elements of a list between start and stop inclusive.
+func (c *Client) LRange(key string, start, stop int64) ([]string, error) {
+	return stringsReply(c.Call("LRANGE", key, start, stop))
+}
+
+// BLPop pops the first element of the first non-empty list, waiting for up to
+// timeout for one to become available. It returns the key of the list along
+// with the element, or ErrNil if the timeout expired. A zero timeout waits
+// indefinitely.
+func (c *Client) BLPop(timeout time.Duration, keys ...string) (string, []byte, error) {
+	return c.bpop("BLPOP", timeout, keys)
+}
+
+// BRPop is like BLPop, but pops the last element.
+func (c *Client) BRPop(timeout time.Duration, keys ...string) (string, []byte, error) {
+	return c.bpop("BRPOP", timeout, keys)
+}
+
+// SAdd adds members to a set and returns the number of new members.
+func (c *Client) SAdd(key string, members ...interface{}) (int64, error) {
+	return intReply(c.Call(append([]interface{}{"SADD", key}, members...)...))
+}
+
+// SMembers returns all the members of a set.
+func (c *Client) SMembers(key string) ([]string, error) {
+	return stringsReply(c.Call("SMEMBERS", key))
+}
+
+// ZAdd adds members to a sorted set and returns the number of new members.
+func (c *Client) ZAdd(key string, members ...Z) (int64, error) {
+	args := make([]interface{}, 0, len(members)*2+2)
+	args = append(args, "ZADD", key)
+	for _, m := range members {
+		args = append(args, strconv.FormatFloat(m.Score, 'g', -1, 64), m.Member)
+	}
+	return intReply(c.Call(args...))
+}
+
+// BZPopMin pops the member with the lowest score from the first non-empty
+// sorted set, waiting for up to timeout for one to become available. It
+// returns the key of the sorted set along with the member, or ErrNil if the
+// timeout expired. A zero timeout waits indefinitely.
+func (c *Client) BZPopMin(timeout time.Duration, keys ...string) (string, Z, error) {
+	r, err := arrayReply(c.blocking("BZPOPMIN", timeout, keys))
+	if err != nil {
+		return "", Z{}, err
+	}
+	if r.Len() != 3 {
+		return "", Z{}, ErrUnexpectedReply
+	}
+	score, err := r.Elems[2].Elem.ParseFloat()
+	if err != nil {
+		return "", Z{}, err
+	}
+	return r.Elems[0].Elem.String(), Z{Member: r.Elems[1].Elem.String(), Score: score}, nil
+}
+
+// ZRangeWithScores returns the members of a sorted set between start and stop
+// inclusive, along with their scores.
+func (c *Client) ZRangeWithScores(key string, start, stop int64) ([]Z, error) {
+	r, err := arrayReply(c.Call("ZRANGE", key, start, stop, "WITHSCORES"))
+	if err != nil {
+		return nil, err
+	}
+
+	// RESP3 nests each member and score pair in an array
+	var pairs [][2]*Reply
+	if r.Len() > 0 && r.Elems[0].Elems != nil {
+		for _, e := range r.Elems {
+			if e.Len() != 2 {
+				return nil, ErrUnexpectedReply
+			}
+			pairs = append(pairs, [2]*Reply{e.Elems[0], e.Elems[1]})
+		}
+	} else {
+		if r.Len()%2 == 1 {
+			return nil, ErrUnexpectedReply
+		}
+		for i := 0; i < r.Len(); i += 2 {
+			pairs = append(pairs, [2]*Reply{r.Elems[i], r.Elems[i+1]})
+		}
+	}
+
+	zs := make([]Z, len(pairs))
+	for i, p := range pairs {
+		score, err := p[1].Elem.ParseFloat()
+		if err != nil {
+			return nil, err
+		}
+		zs[i] = Z{Member: p[0].Elem.String(), Score: score}
+	}
+	return zs, nil
+}
+
+// Scan iterates the keys, returning a batch of keys and the cursor to pass to
+// the next call. Iteration is complete when the returned cursor is 0. An
+// empty match pattern or zero count use the server defaults.
+func (c *Client) Scan(cursor uint64, match string, count int64) ([]string, uint64, error) {
+	args := []interface{}{"SCAN", cursor}
+	if match != "" {
+		args = append(args, "MATCH", match)
+	}
+	if count != 0 {
+		args = append(args, "COUNT", count)
+	}
+	r, err := arrayReply(c.Call(args...))
+	if err != nil {
+		return nil, 0, err
+	}
+	if r.Len() != 2 {
+		return nil, 0, ErrUnexpectedReply
+	}
+	next, err := strconv.ParseUint(r.Elems[0].Elem.String(), 10, 64)
+	if err != nil {
+		return nil, 0, err
+	}
+	keys, err := stringsReply(r.Elems[1], nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	return keys, next, nil
+}
+
+// Wait blocks until the preceding writes on the connection are acknowledged
+// by at least numReplicas replicas, or the timeout expires. It returns the
+// number of replicas that acknowledged them. A zero timeout waits
+// indefinitely.
+//
+// Since the writes need to be on the same connection, Wait is typically
+// queued in a Pipeline or a Transaction rather than called on its own.
+func (c *Client) Wait(numReplicas int, timeout time.Duration) (int64, error) {
+	return intReply(c.CallWithTimeout(
+		timeout, "WAIT", numReplicas, int64(timeout/time.Millisecond)))
+}
+
+func (c *Client) bpop(cmd string, timeout time.Duration, keys []string) (string, []byte, error) {
+	r, err := arrayReply(c.blocking(cmd, timeout, keys))
+	if err != nil {
+		return "", nil, err
+	}
+	if r.Len() != 2 {
+		return "", nil, ErrUnexpectedReply
+	}
+	return r.Elems[0].Elem.String(), r.Elems[1].Elem.Bytes(), nil
+}
+
+// Call a blocking command which takes keys followed by the timeout in
+// seconds, returning ErrNil if the timeout expired.
+func (c *Client) blocking(cmd string, timeout time.Duration, keys []string) (*Reply, error) {
+	args := make([]interface{}, 0, len(keys)+2)
+	args = append(args, cmd)
+	for _, k := range keys {
+		args = append(args, k)
+	}
+	args = append(args, strconv.FormatFloat(timeout.Seconds(), 'f', -1, 64))
+	r, err := c.CallWithTimeout(timeout, args...)
+	if err == ErrNilMultiBulk || (err == nil && r.Nil()) {
+		return nil, ErrNil
+	}
+	return r, err
+}
+
+// Check for a nil reply, and a reply of the expected kinds.
+func checkReply(r *Reply, err error, kinds ...Kind) (*Reply, error) {
+	if err != nil {
+		return nil, err
+	}
+	if r.Nil() {
+		return nil, ErrNil
+	}
+	for _, k := range kinds {
+		if r.Kind == k {
+			return r, nil
+		}
+	}
+	return nil, ErrUnexpectedReply
+}
+
+func statusReply(r *Reply, err error) error {
+	_, err = checkReply(r, err, KindStatus)
+	return err
+}
+
+func intReply(r *Reply, err error) (int64, error) {
+	r, err = checkReply(r, err, KindInt)
+	if err != nil {
+		return 0, err
+	}
+	return r.Elem.ParseInt()
+}
+
+func boolReply(r *Reply, err error) (bool, error) {
+	n, err := intReply(r, err)
+	return n == 1, err
+}
+
+func bytesReply(r *Reply, err error) ([]byte, error) {
+	r, err = checkReply(r, err, KindBulk, KindStatus, KindVerbatim)
+	if err != nil {
+		return nil, err
+	}
+	return r.Elem.Bytes(), nil
+}
+
+func arrayReply(r *Reply, err error) (*Reply, error) {
+	if err != nil {
+		return nil, err
+	}
+	switch r.Kind {
+	case KindArray, KindSet, KindMap:
+		return r, nil
+	}
+	return nil, ErrUnexpectedReply
+}
+
+func stringsReply(r *Reply, err error) ([]string, error) {
+	r, err = arrayReply(r, err)
+	if err != nil {
+		return nil, err
+	}
+	return r.Strings()
+}
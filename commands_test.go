@@ -0,0 +1,186 @@
+package redis_test
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/daaku/go.redis"
+	"github.com/daaku/go.redis/redistest"
+)
+
+func TestGetSet(t *testing.T) {
+	server, client := redistest.NewServerClient(t)
+	defer server.Close()
+	if _, err := client.Get("foo"); err != redis.ErrNil {
+		t.Fatalf("was expecting ErrNil but got %v", err)
+	}
+	ok, err := client.Set("foo", "bar", nil)
+	if err != nil || !ok {
+		t.Fatalf("was expecting set but got %v %v", ok, err)
+	}
+	ok, err = client.Set("foo", "baz", &redis.SetOptions{NX: true})
+	if err != nil || ok {
+		t.Fatalf("was not expecting set but got %v %v", ok, err)
+	}
+	value, err := client.Get("foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(value) != "bar" {
+		t.Fatalf("was expecting bar but got %s", value)
+	}
+	values, err := client.MGet("foo", "missing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(values) != 2 || string(values[0]) != "bar" || values[1] != nil {
+		t.Fatalf("unexpected values %q", values)
+	}
+	if _, err := client.Incr("foo"); err == nil {
+		t.Fatal("was expecting INCR on a string to fail")
+	}
+}
+
+func TestCounters(t *testing.T) {
+	server, client := redistest.NewServerClient(t)
+	defer server.Close()
+	if n, err := client.Incr("counter"); err != nil || n != 1 {
+		t.Fatalf("was expecting 1 but got %d %v", n, err)
+	}
+	if n, err := client.IncrBy("counter", 41); err != nil || n != 42 {
+		t.Fatalf("was expecting 42 but got %d %v", n, err)
+	}
+	if ok, err := client.Expire("counter", time.Minute); err != nil || !ok {
+		t.Fatalf("was expecting expire but got %v %v", ok, err)
+	}
+	if ok, err := client.Exists("counter"); err != nil || !ok {
+		t.Fatalf("was expecting key to exist but got %v %v", ok, err)
+	}
+	if n, err := client.Del("counter", "missing"); err != nil || n != 1 {
+		t.Fatalf("was expecting 1 but got %d %v", n, err)
+	}
+	if ok, err := client.Expire("counter", time.Minute); err != nil || ok {
+		t.Fatalf("was not expecting expire but got %v %v", ok, err)
+	}
+}
+
+func TestHash(t *testing.T) {
+	server, client := redistest.NewServerClient(t)
+	defer server.Close()
+	if ok, err := client.HSet("h", "a", 1); err != nil || !ok {
+		t.Fatalf("was expecting new field but got %v %v", ok, err)
+	}
+	if _, err := client.HSet("h", "b", "2"); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := client.HGet("h", "a"); err != nil || string(v) != "1" {
+		t.Fatalf("was expecting 1 but got %s %v", v, err)
+	}
+	if _, err := client.HGet("h", "c"); err != redis.ErrNil {
+		t.Fatalf("was expecting ErrNil but got %v", err)
+	}
+	h, err := client.HGetAll("h")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(h, map[string]string{"a": "1", "b": "2"}) {
+		t.Fatalf("unexpected hash %v", h)
+	}
+	if n, err := client.HDel("h", "a", "c"); err != nil || n != 1 {
+		t.Fatalf("was expecting 1 but got %d %v", n, err)
+	}
+}
+
+func TestListSet(t *testing.T) {
+	server, client := redistest.NewServerClient(t)
+	defer server.Close()
+	if _, err := client.RPush("l", "b", "c"); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := client.LPush("l", "a"); err != nil || n != 3 {
+		t.Fatalf("was expecting 3 but got %d %v", n, err)
+	}
+	l, err := client.LRange("l", 0, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(l, []string{"a", "b", "c"}) {
+		t.Fatalf("unexpected list %v", l)
+	}
+	if n, err := client.SAdd("s", "a", "a"); err != nil || n != 1 {
+		t.Fatalf("was expecting 1 but got %d %v", n, err)
+	}
+	s, err := client.SMembers("s")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(s, []string{"a"}) {
+		t.Fatalf("unexpected set %v", s)
+	}
+}
+
+func TestZRangeWithScores(t *testing.T) {
+	server, client := redistest.NewServerClient(t)
+	defer server.Close()
+	expected := []redis.Z{{Member: "a", Score: 1}, {Member: "b", Score: 2.5}}
+	if n, err := client.ZAdd("z", expected[1], expected[0]); err != nil || n != 2 {
+		t.Fatalf("was expecting 2 but got %d %v", n, err)
+	}
+	zs, err := client.ZRangeWithScores("z", 0, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(zs, expected) {
+		t.Fatalf("unexpected members %v", zs)
+	}
+}
+
+func TestScan(t *testing.T) {
+	server, client := redistest.NewServerClient(t)
+	defer server.Close()
+	for _, k := range []string{"a1", "a2", "b1"} {
+		if _, err := client.Set(k, "", nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var found []string
+	var cursor uint64
+	for {
+		keys, next, err := client.Scan(cursor, "a*", 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		found = append(found, keys...)
+		if next == 0 {
+			break
+		}
+		cursor = next
+	}
+	if len(found) != 2 {
+		t.Fatalf("was expecting 2 keys but got %v", found)
+	}
+}
+
+func TestBlockingPop(t *testing.T) {
+	server, client := redistest.NewServerClient(t)
+	defer server.Close()
+	client.Timeout = 50 * time.Millisecond
+	if _, _, err := client.BLPop(200*time.Millisecond, "list"); err != redis.ErrNil {
+		t.Fatalf("was expecting ErrNil but got %v", err)
+	}
+	if _, err := client.RPush("list", "a", "b"); err != nil {
+		t.Fatal(err)
+	}
+	key, value, err := client.BRPop(time.Second, "missing", "list")
+	if err != nil || key != "list" || string(value) != "b" {
+		t.Fatalf("unexpected pop %q %q %v", key, value, err)
+	}
+	if _, err := client.ZAdd("zset", redis.Z{Member: "m", Score: 1.5}); err != nil {
+		t.Fatal(err)
+	}
+	key, z, err := client.BZPopMin(time.Second, "zset")
+	if err != nil || key != "zset" || z != (redis.Z{Member: "m", Score: 1.5}) {
+		t.Fatalf("unexpected pop %q %v %v", key, z, err)
+	}
+}
@@ -1,6 +1,7 @@
 package redis
 
 import (
+	"crypto/tls"
 	"github.com/daaku/go.redis/bufin"
 	"net"
 	"time"
@@ -31,9 +32,15 @@ type Conn interface {
 	Sock() net.Conn
 }
 
+// Write buffers which grew larger than this are not kept for reuse.
+const maxWriteBuffer = 64 * 1024
+
 type connection struct {
-	rbuf *bufin.Reader
-	conn net.Conn
+	rbuf     *bufin.Reader
+	wbuf     []byte
+	streamed bool // part of the buffered commands was sent
+	conn     net.Conn
+	err      error
 }
 
 // Dial expects a network address, protocol and a dial timeout:
@@ -48,26 +55,135 @@ func Dial(addr, proto string, timeout time.Duration) (Conn, error) {
 	if err != nil {
 		return nil, err
 	}
-	c := &connection{bufin.NewReader(conn), conn}
-	return c, nil
+	return newConnection(conn), nil
+}
+
+// DialTLS is like Dial for TCP, but establishes a TLS connection using the
+// given config. If the config does not specify a ServerName the host of the
+// address is verified:
+//
+//     DialTLS("redis.example.com:6380", time.Second, &tls.Config{})
+func DialTLS(addr string, timeout time.Duration, config *tls.Config) (Conn, error) {
+	dialer := &net.Dialer{Timeout: timeout}
+	conn, err := tls.DialWithDialer(dialer, "tcp", addr, config)
+	if err != nil {
+		return nil, err
+	}
+	return newConnection(conn), nil
+}
+
+func newConnection(conn net.Conn) *connection {
+	rbuf := bufin.NewReaderSize(conn, bufin.DefaultSize, MaxLineLen)
+	return &connection{rbuf: rbuf, conn: conn}
+}
+
+// Record an error unless it was sent by the server. A partial read or write
+// means the next reply can no longer be matched to its command.
+func (c *connection) fail(err error) {
+	if c.err == nil && !IsRedisError(err) && err != ErrNilMultiBulk {
+		c.err = err
+	}
 }
 
 func (c *connection) Read() (*Reply, error) {
+	reply, err := c.readReply()
+	if err != nil {
+		return nil, err
+	}
+	return reply, nil
+}
+
+// Read a reply, returning it along with the error it carries so nested
+// replies, such as those of EXEC, can still be inspected.
+func (c *connection) readReply() (*Reply, error) {
+	if c.err != nil {
+		return nil, c.err
+	}
 	reply := parse(c.rbuf)
 	if reply.Err != nil {
-		return nil, reply.Err
+		c.fail(reply.Err)
+		return reply, reply.Err
 	}
 	return reply, nil
 }
 
 func (c *connection) Write(args ...interface{}) error {
-	_, err := c.conn.Write(format(args...))
+	if c.err != nil {
+		return c.err
+	}
+	c.wbuf = c.wbuf[:0]
+	c.streamed = false
+	if err := c.buffer(args); err != nil {
+		return c.abort(err)
+	}
+	return c.flush()
+}
+
+// Write several commands using a single write on the underlying connection.
+// The replies must be read back in order using Read.
+func (c *connection) WriteBatch(cmds [][]interface{}) error {
+	if c.err != nil {
+		return c.err
+	}
+	c.wbuf = c.wbuf[:0]
+	c.streamed = false
+	for _, args := range cmds {
+		if err := c.buffer(args); err != nil {
+			return c.abort(err)
+		}
+	}
+	return c.flush()
+}
+
+// Encode a command into the write buffer. ReaderArg arguments are streamed
+// to the connection instead, after sending what was buffered before them.
+func (c *connection) buffer(args []interface{}) error {
+	for _, arg := range args {
+		if _, ok := arg.(ReaderArg); ok {
+			return c.bufferStream(args)
+		}
+	}
+	buf, err := appendCommand(c.wbuf, args)
+	if err != nil {
+		return err
+	}
+	c.wbuf = buf
+	return nil
+}
+
+// Discard the buffered commands after an error. If some of them were already
+// streamed the connection can no longer be used.
+func (c *connection) abort(err error) error {
+	c.wbuf = c.wbuf[:0]
+	if c.streamed {
+		c.fail(err)
+	}
+	return err
+}
+
+// Send the buffered commands using a single write. The buffer is kept for
+// the next commands unless it grew too large.
+func (c *connection) flush() error {
+	_, err := c.conn.Write(c.wbuf)
+	if cap(c.wbuf) > maxWriteBuffer {
+		c.wbuf = nil
+	} else {
+		c.wbuf = c.wbuf[:0]
+	}
 	if err != nil {
+		c.fail(err)
 		return err
 	}
 	return nil
 }
 
+// Returns the network or protocol error which left the connection in an
+// unknown state, if any. Once set, all further reads and writes fail with it.
+// Errors sent by the server do not affect the connection.
+func (c *connection) Err() error {
+	return c.err
+}
+
 func (c *connection) Close() error {
 	return c.conn.Close()
 }
@@ -0,0 +1,158 @@
+package redis
+
+import (
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+// A net.Conn which returns scripted chunks of data and errors from Read.
+type faultConn struct {
+	reads   []interface{} // string or error
+	written []byte
+	closed  bool
+}
+
+func (f *faultConn) Read(p []byte) (int, error) {
+	if f.closed {
+		return 0, errors.New("use of closed connection")
+	}
+	if len(f.reads) == 0 {
+		return 0, io.EOF
+	}
+	switch v := f.reads[0].(type) {
+	case error:
+		f.reads = f.reads[1:]
+		return 0, v
+	case string:
+		n := copy(p, v)
+		if n == len(v) {
+			f.reads = f.reads[1:]
+		} else {
+			f.reads[0] = v[n:]
+		}
+		return n, nil
+	}
+	panic("unexpected read")
+}
+
+func (f *faultConn) Write(p []byte) (int, error) {
+	if f.closed {
+		return 0, errors.New("use of closed connection")
+	}
+	f.written = append(f.written, p...)
+	return len(p), nil
+}
+
+func (f *faultConn) Close() error                       { f.closed = true; return nil }
+func (f *faultConn) LocalAddr() net.Addr                { return nil }
+func (f *faultConn) RemoteAddr() net.Addr               { return nil }
+func (f *faultConn) SetDeadline(t time.Time) error      { return nil }
+func (f *faultConn) SetReadDeadline(t time.Time) error  { return nil }
+func (f *faultConn) SetWriteDeadline(t time.Time) error { return nil }
+
+// A Client whose pool holds a single connection over the faultConn.
+func faultClient(f *faultConn) *Client {
+	c := &Client{PoolSize: 1, Timeout: time.Second}
+	c.init()
+	<-c.pool
+	now := time.Now()
+	c.pool <- &pooledConn{connection: newConnection(f), created: now, used: now}
+	return c
+}
+
+func TestPoisonedByPartialReply(t *testing.T) {
+	f := &faultConn{reads: []interface{}{"$5\r\nhel", timeoutError{}, "lo\r\n+OK\r\n"}}
+	c := faultClient(f)
+	if _, err := c.Call("GET", "foo"); err == nil {
+		t.Fatal("was expecting timeout error")
+	}
+	if !f.closed {
+		t.Fatal("was expecting the connection to be closed")
+	}
+	if conn := <-c.pool; conn != nil {
+		t.Fatal("was expecting the connection to be discarded")
+	}
+}
+
+func TestPoisonedByProtocolError(t *testing.T) {
+	f := &faultConn{reads: []interface{}{"?what\r\n", "+OK\r\n"}}
+	c := faultClient(f)
+	if _, err := c.Call("PING"); !errors.Is(err, ErrProtocol) {
+		t.Fatalf("was expecting ErrProtocol but got %v", err)
+	}
+	if !f.closed {
+		t.Fatal("was expecting the connection to be closed")
+	}
+}
+
+func TestPoisonedInsideArray(t *testing.T) {
+	f := &faultConn{reads: []interface{}{
+		"*3\r\n$1\r\na\r\n$3\r\nb", io.ErrUnexpectedEOF, "c\r\n$1\r\nd\r\n"}}
+	c := faultClient(f)
+	if _, err := c.Call("MGET", "a", "b", "c"); err == nil {
+		t.Fatal("was expecting error")
+	}
+	if !f.closed {
+		t.Fatal("was expecting the connection to be closed")
+	}
+}
+
+func TestServerErrorKeepsConnection(t *testing.T) {
+	f := &faultConn{reads: []interface{}{
+		"-ERR bad\r\n",
+		"*2\r\n-WRONGTYPE nope\r\n:1\r\n",
+		"+OK\r\n",
+	}}
+	c := faultClient(f)
+	if _, err := c.Call("BAD"); !IsRedisError(err) {
+		t.Fatalf("was expecting a server error but got %v", err)
+	}
+	if _, err := c.Call("EXEC"); !IsWrongType(err) {
+		t.Fatalf("was expecting a nested server error but got %v", err)
+	}
+	reply, err := c.Call("PING")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reply.Elem.String() != "OK" {
+		t.Fatalf("reply desynchronized, got %s", reply.Elem)
+	}
+	if f.closed {
+		t.Fatal("was not expecting the connection to be closed")
+	}
+}
+
+func TestStickyError(t *testing.T) {
+	f := &faultConn{reads: []interface{}{"$5\r\nhel", timeoutError{}, "lo\r\n+OK\r\n"}}
+	conn := newConnection(f)
+	if _, err := conn.Read(); err == nil {
+		t.Fatal("was expecting timeout error")
+	}
+	if _, err := conn.Read(); err != conn.Err() || err == nil {
+		t.Fatalf("was expecting the sticky error but got %v", err)
+	}
+	if err := conn.Write("PING"); err != conn.Err() {
+		t.Fatalf("was expecting the sticky error but got %v", err)
+	}
+	if len(f.reads) != 1 || len(f.written) != 0 {
+		t.Fatal("was not expecting the socket to be used")
+	}
+}
+
+func TestReadErrorReply(t *testing.T) {
+	f := &faultConn{reads: []interface{}{"*2\r\n-WRONGTYPE nope\r\n:1\r\n"}}
+	var conn Conn = newConnection(f)
+	reply, err := conn.Read()
+	if !IsWrongType(err) || reply != nil {
+		t.Fatalf("was expecting only the error but got %v %v", reply, err)
+	}
+}
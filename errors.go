@@ -0,0 +1,93 @@
+package redis
+
+import (
+	"errors"
+	"strings"
+)
+
+// RedisError is an error reply sent by the server, like:
+//
+//     ERR unknown command 'FOO'
+//     WRONGTYPE Operation against a key holding the wrong kind of value
+//
+// Server errors leave the connection usable, unlike network and protocol
+// errors.
+type RedisError struct {
+	Code    string // The leading uppercase word like "ERR" or "WRONGTYPE", if any
+	Message string // The rest of the error
+}
+
+// Parse an error line sent by the server.
+func newRedisError(line string) *RedisError {
+	code, message := line, ""
+	if i := strings.IndexByte(line, ' '); i >= 0 {
+		code, message = line[:i], line[i+1:]
+	}
+	if code == "" || strings.ToUpper(code) != code {
+		return &RedisError{Message: line}
+	}
+	return &RedisError{Code: code, Message: message}
+}
+
+func (e *RedisError) Error() string {
+	if e.Code == "" {
+		return e.Message
+	}
+	if e.Message == "" {
+		return e.Code
+	}
+	return e.Code + " " + e.Message
+}
+
+// IsRedisError returns true if the error was sent by the server.
+func IsRedisError(err error) bool {
+	var e *RedisError
+	return errors.As(err, &e)
+}
+
+// Returns the code of a server error, or an empty string.
+func errCode(err error) string {
+	var e *RedisError
+	if errors.As(err, &e) {
+		return e.Code
+	}
+	return ""
+}
+
+// IsWrongType returns true for WRONGTYPE errors, sent when a command is used
+// against a key holding a different kind of value.
+func IsWrongType(err error) bool {
+	return errCode(err) == "WRONGTYPE"
+}
+
+// IsMoved returns true for MOVED redirects from a Redis Cluster.
+func IsMoved(err error) bool {
+	return errCode(err) == "MOVED"
+}
+
+// IsAsk returns true for ASK redirects from a Redis Cluster.
+func IsAsk(err error) bool {
+	return errCode(err) == "ASK"
+}
+
+// IsNoScript returns true for NOSCRIPT errors, sent by EVALSHA when the script
+// is not cached.
+func IsNoScript(err error) bool {
+	return errCode(err) == "NOSCRIPT"
+}
+
+// IsLoading returns true for LOADING errors, sent while the server is loading
+// the dataset.
+func IsLoading(err error) bool {
+	return errCode(err) == "LOADING"
+}
+
+// IsReadOnly returns true for READONLY errors, sent when writing to a replica.
+func IsReadOnly(err error) bool {
+	return errCode(err) == "READONLY"
+}
+
+// IsBusy returns true for BUSY errors, sent while a script is running.
+func IsBusy(err error) bool {
+	return errCode(err) == "BUSY"
+}
@@ -0,0 +1,50 @@
+package redis_test
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/daaku/go.redis"
+	"github.com/daaku/go.redis/redistest"
+)
+
+func TestRedisError(t *testing.T) {
+	server, client := redistest.NewServerClient(t)
+	defer server.Close()
+	if _, err := client.Call("SET", "foo", "bar"); err != nil {
+		t.Fatal(err)
+	}
+	_, err := client.Call("INCR", "foo")
+	if !redis.IsRedisError(err) {
+		t.Fatalf("was expecting a server error but got %v", err)
+	}
+	_, err = client.Call("LPUSH", "foo", "bar")
+	if !redis.IsWrongType(err) {
+		t.Fatalf("was expecting WRONGTYPE but got %v", err)
+	}
+	var e *redis.RedisError
+	if !errors.As(err, &e) || e.Code != "WRONGTYPE" || e.Message == "" {
+		t.Fatalf("unexpected error %#v", err)
+	}
+	if _, err := client.Call("GET", "foo"); err != nil {
+		t.Fatalf("was expecting the connection to be usable but got %v", err)
+	}
+}
+
+func TestRedisErrorPredicates(t *testing.T) {
+	if redis.IsRedisError(errors.New("ERR foo")) {
+		t.Error("was not expecting a plain error to be a server error")
+	}
+	moved := &redis.RedisError{Code: "MOVED", Message: "3999 127.0.0.1:6381"}
+	if !redis.IsMoved(fmt.Errorf("wrapped: %w", moved)) {
+		t.Error("was expecting a wrapped MOVED error to be detected")
+	}
+	if moved.Error() != "MOVED 3999 127.0.0.1:6381" {
+		t.Errorf("unexpected message %s", moved)
+	}
+	if redis.IsBusy(moved) || redis.IsLoading(moved) || redis.IsNoScript(moved) ||
+		redis.IsReadOnly(moved) || redis.IsAsk(moved) {
+		t.Error("was only expecting IsMoved to match")
+	}
+}
@@ -0,0 +1,124 @@
+package redis_test
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// A fake node which answers commands using a handler. The handler gets the
+// commands sent so far on the same connection.
+type fakeNode struct {
+	listener net.Listener
+	handler  func(cmd []string, prev []string) string
+	conns    map[net.Conn]bool
+	mu       sync.Mutex
+}
+
+func newFakeNode(t *testing.T) *fakeNode {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := &fakeNode{listener: l, conns: make(map[net.Conn]bool)}
+	go n.serve()
+	return n
+}
+
+func (n *fakeNode) Addr() string {
+	return n.listener.Addr().String()
+}
+
+// Stop listening and close the connected clients, as a failed node would.
+func (n *fakeNode) Close() error {
+	err := n.listener.Close()
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for conn := range n.conns {
+		conn.Close()
+	}
+	return err
+}
+
+func (n *fakeNode) Handle(h func(cmd []string, prev []string) string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.handler = h
+}
+
+// Send raw data to all connected clients.
+func (n *fakeNode) Send(data string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for conn := range n.conns {
+		io.WriteString(conn, data)
+	}
+}
+
+func (n *fakeNode) serve() {
+	for {
+		conn, err := n.listener.Accept()
+		if err != nil {
+			return
+		}
+		go n.serveConn(conn)
+	}
+}
+
+func (n *fakeNode) serveConn(conn net.Conn) {
+	n.mu.Lock()
+	n.conns[conn] = true
+	n.mu.Unlock()
+	defer func() {
+		n.mu.Lock()
+		delete(n.conns, conn)
+		n.mu.Unlock()
+		conn.Close()
+	}()
+	r := bufio.NewReader(conn)
+	var prev []string
+	for {
+		cmd, err := readCommand(r)
+		if err != nil {
+			return
+		}
+		n.mu.Lock()
+		_, err = io.WriteString(conn, n.handler(cmd, prev))
+		n.mu.Unlock()
+		if err != nil {
+			return
+		}
+		prev = append(prev, strings.Join(cmd, " "))
+	}
+}
+
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(line[1:]))
+	if err != nil {
+		return nil, err
+	}
+	cmd := make([]string, n)
+	for i := range cmd {
+		if line, err = r.ReadString('\n'); err != nil {
+			return nil, err
+		}
+		l, err := strconv.Atoi(strings.TrimSpace(line[1:]))
+		if err != nil {
+			return nil, err
+		}
+		buf := make([]byte, l+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		cmd[i] = string(buf[:l])
+	}
+	return cmd, nil
+}
@@ -1,9 +1,11 @@
 package redis
 
 import (
-	"bytes"
+	"encoding"
 	"fmt"
+	"reflect"
 	"strconv"
+	"time"
 )
 
 const (
@@ -14,80 +16,174 @@ const (
 	minus  byte = 45
 	plus   byte = 43
 	star   byte = 42
+
+	// RESP3 types
+	percent    byte = 37
+	tilde      byte = 126
+	comma      byte = 44
+	hash       byte = 35
+	underscore byte = 95
+	lparen     byte = 40
+	equals     byte = 61
+	pipe       byte = 124
+	rangle     byte = 62
+	bang       byte = 33
 )
 
 var (
 	delim = []byte{cr, lf}
 )
 
-func intlen(n int) int {
-	l := 1
-
-	if n < 0 {
-		n = -n
-		l++
-	}
+// Build a new command by concencate an array of strings which create
+// a redis command. Besides strings and byte slices, arguments may be integers,
+// floats, bools, sent as 1 or 0, time.Time, sent as RFC 3339, and types
+// implementing RedisArg, encoding.BinaryMarshaler or encoding.TextMarshaler.
+// A nil argument is sent as an empty string. A time.Duration is rejected,
+// since commands disagree on the unit; convert it to seconds or milliseconds.
+func format(args ...interface{}) ([]byte, error) {
+	return appendCommand(nil, args)
+}
 
-	n /= 10
+// Append a command to buf, encoding the arguments straight into it so a
+// reused buffer makes formatting free of allocations.
+func appendCommand(buf []byte, args []interface{}) ([]byte, error) {
+	buf = appendArrayHeader(buf, len(args))
 
-	for n > 9 {
-		l++
-		n /= 10
+	for _, arg := range args {
+		var err error
+		if buf, err = appendBulk(buf, arg); err != nil {
+			return nil, err
+		}
 	}
 
-	return l
-}
-
-func arglen(arg []byte) int {
-	//     $   datalen   \r\n data \r\n
-	return 1 + intlen(len(arg)) + 2 + len(arg) + 2
+	return buf, nil
 }
 
-// Build a new command by concencating an array of bytes which create a
-// redis command.
-func formatArgs(args [][]byte) []byte {
-	//   *   args count         \r\n
-	n := 1 + intlen(len(args)) + 2
-
-	for i := 0; i < len(args); i++ {
-		n += arglen(args[i])
+// Append an argument as a bulk string.
+func appendBulk(buf []byte, arg interface{}) ([]byte, error) {
+	switch v := arg.(type) {
+	case string:
+		buf = appendBulkHeader(buf, int64(len(v)))
+		buf = append(buf, v...)
+	case []byte:
+		buf = appendBulkHeader(buf, int64(len(v)))
+		buf = append(buf, v...)
+	default:
+		// encode the value first, and then move it to make room for the
+		// header once its length is known
+		start := len(buf)
+		var err error
+		buf, err = appendArg(buf, v)
+		if err != nil {
+			return nil, err
+		}
+		n := len(buf) - start
+		var h [24]byte
+		header := appendBulkHeader(h[:0], int64(n))
+		buf = append(buf, header...)
+		copy(buf[start+len(header):], buf[start:start+n])
+		copy(buf[start:], header)
 	}
+	return append(buf, delim...), nil
+}
 
-	buf := make([]byte, 0, n)
+func appendArrayHeader(buf []byte, n int) []byte {
 	buf = append(buf, star)
-	buf = strconv.AppendUint(buf, uint64(len(args)), 10)
-	buf = append(buf, delim...)
+	buf = strconv.AppendUint(buf, uint64(n), 10)
+	return append(buf, delim...)
+}
 
-	for _, arg := range args {
-		buf = append(buf, dollar)
-		buf = strconv.AppendUint(buf, uint64(len(arg)), 10)
-		buf = append(buf, delim...)
-		buf = append(buf, arg...)
-		buf = append(buf, delim...)
-	}
+func appendBulkHeader(buf []byte, n int64) []byte {
+	buf = append(buf, dollar)
+	buf = strconv.AppendInt(buf, n, 10)
+	return append(buf, delim...)
+}
 
-	return buf
+// RedisArg is implemented by types which choose how they are sent as a
+// command argument. The returned value is sent in their place.
+type RedisArg interface {
+	RedisArg() interface{}
 }
 
-// Build a new command by concencate an array of strings which create
-// a redis command.
-func format(args ...interface{}) []byte {
-	buf := make([][]byte, len(args))
+// Append the value of a command argument.
+func appendArg(buf []byte, arg interface{}) ([]byte, error) {
+	switch v := arg.(type) {
+	case []byte:
+		return append(buf, v...), nil
+	case string:
+		return append(buf, v...), nil
+	case nil:
+		return buf, nil
+	case int:
+		return strconv.AppendInt(buf, int64(v), 10), nil
+	case int8:
+		return strconv.AppendInt(buf, int64(v), 10), nil
+	case int16:
+		return strconv.AppendInt(buf, int64(v), 10), nil
+	case int32:
+		return strconv.AppendInt(buf, int64(v), 10), nil
+	case int64:
+		return strconv.AppendInt(buf, v, 10), nil
+	case uint:
+		return strconv.AppendUint(buf, uint64(v), 10), nil
+	case uint8:
+		return strconv.AppendUint(buf, uint64(v), 10), nil
+	case uint16:
+		return strconv.AppendUint(buf, uint64(v), 10), nil
+	case uint32:
+		return strconv.AppendUint(buf, uint64(v), 10), nil
+	case uint64:
+		return strconv.AppendUint(buf, v, 10), nil
+	case float32:
+		return strconv.AppendFloat(buf, float64(v), 'g', -1, 32), nil
+	case float64:
+		return strconv.AppendFloat(buf, v, 'g', -1, 64), nil
+	case bool:
+		return appendBool(buf, v), nil
+	case time.Time:
+		return v.AppendFormat(buf, time.RFC3339Nano), nil
+	case time.Duration:
+		return nil, fmt.Errorf("go.redis: unsupported argument type %T, convert it to seconds or milliseconds", arg)
+	case RedisArg:
+		return appendArg(buf, v.RedisArg())
+	case encoding.BinaryMarshaler:
+		b, err := v.MarshalBinary()
+		if err != nil {
+			return nil, fmt.Errorf("go.redis: marshaling argument of type %T: %w", arg, err)
+		}
+		return append(buf, b...), nil
+	case encoding.TextMarshaler:
+		b, err := v.MarshalText()
+		if err != nil {
+			return nil, fmt.Errorf("go.redis: marshaling argument of type %T: %w", arg, err)
+		}
+		return append(buf, b...), nil
+	}
 
-	for i, arg := range args {
-		switch v := arg.(type) {
-		case []byte:
-			buf[i] = v
-		case nil:
-			buf[i] = []byte(nil)
-		case string:
-			buf[i] = []byte(v)
-		default:
-			var b bytes.Buffer
-			fmt.Fprint(&b, v)
-			buf[i] = b.Bytes()
+	// named types of the basic kinds
+	v := reflect.ValueOf(arg)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.AppendInt(buf, v.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.AppendUint(buf, v.Uint(), 10), nil
+	case reflect.Float32, reflect.Float64:
+		return strconv.AppendFloat(buf, v.Float(), 'g', -1, v.Type().Bits()), nil
+	case reflect.Bool:
+		return appendBool(buf, v.Bool()), nil
+	case reflect.String:
+		return append(buf, v.String()...), nil
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return append(buf, v.Bytes()...), nil
 		}
 	}
+	return nil, fmt.Errorf("go.redis: unsupported argument type %T", arg)
+}
 
-	return formatArgs(buf)
+func appendBool(buf []byte, b bool) []byte {
+	if b {
+		return append(buf, '1')
+	}
+	return append(buf, '0')
 }
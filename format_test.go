@@ -1,25 +1,159 @@
 package redis
 
 import (
+	"errors"
+	"strings"
 	"testing"
+	"time"
 )
 
 func formatTest(t *testing.T, exp string, a ...interface{}) {
-	got := format(a...)
+	got, err := format(a...)
+	if err != nil {
+		t.Errorf("format: unexpected error %s", err)
+	}
 
 	if exp != string(got) {
 		t.Errorf("format: expected %s got %s", exp, string(got))
 	}
 }
 
+type argID int
+
+func (id argID) RedisArg() interface{} {
+	return "id:" + string(rune('0'+id))
+}
+
+type textArg struct{ err error }
+
+func (a textArg) MarshalText() ([]byte, error) {
+	return []byte("text"), a.err
+}
+
 func TestFormat(t *testing.T) {
 	formatTest(t, "*2\r\n$4\r\nPING\r\n$4\r\nPONG\r\n", "PING", "PONG")
 	formatTest(t, "*3\r\n$3\r\nSET\r\n$3\r\nfoo\r\n$3\r\nbar\r\n", "SET", "foo", "bar")
 	formatTest(t, "*2\r\n$3\r\nGET\r\n$3\r\nfoo\r\n", "GET", "foo")
 }
 
+func TestFormatArgs(t *testing.T) {
+	cases := []struct {
+		arg interface{}
+		exp string
+	}{
+		{nil, ""},
+		{-42, "-42"},
+		{int8(-8), "-8"},
+		{uint64(18446744073709551615), "18446744073709551615"},
+		{1.5, "1.5"},
+		{float32(0.1), "0.1"},
+		{1e21, "1e+21"},
+		{true, "1"},
+		{false, "0"},
+		{time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC), "2020-01-02T03:04:05Z"},
+		{argID(7), "id:7"},
+		{textArg{}, "text"},
+	}
+	for _, c := range cases {
+		got, err := appendArg(nil, c.arg)
+		if err != nil {
+			t.Errorf("format %v: unexpected error %s", c.arg, err)
+			continue
+		}
+		if string(got) != c.exp {
+			t.Errorf("format %v: expected %q got %q", c.arg, c.exp, got)
+		}
+	}
+}
+
+func TestFormatErrors(t *testing.T) {
+	if _, err := format("SET", "foo", map[string]int{}); err == nil ||
+		!strings.Contains(err.Error(), "map[string]int") {
+		t.Errorf("was expecting an unsupported type error but got %v", err)
+	}
+	if _, err := format("EXPIRE", "foo", time.Second); err == nil ||
+		!strings.Contains(err.Error(), "time.Duration") {
+		t.Errorf("was expecting time.Duration to be rejected but got %v", err)
+	}
+	marshal := errors.New("marshal error")
+	if _, err := format("SET", "foo", textArg{err: marshal}); !errors.Is(err, marshal) {
+		t.Errorf("was expecting the marshal error but got %v", err)
+	}
+}
+
+func TestWriteUnsupportedArg(t *testing.T) {
+	f := &faultConn{}
+	conn := newConnection(f)
+	if err := conn.Write("SET", "foo", struct{}{}); err == nil {
+		t.Fatal("was expecting an error")
+	}
+	if len(f.written) != 0 || conn.Err() != nil {
+		t.Fatalf("was expecting nothing written and a usable connection")
+	}
+}
+
+func TestAppendCommandAllocs(t *testing.T) {
+	args := []interface{}{"SET", "foo", []byte("bar"), 42, 1.5, true}
+	buf, _ := appendCommand(nil, args)
+	allocs := testing.AllocsPerRun(100, func() {
+		buf, _ = appendCommand(buf[:0], args)
+	})
+	if allocs != 0 {
+		t.Fatalf("was expecting no allocations but got %v", allocs)
+	}
+	exp := "*6\r\n$3\r\nSET\r\n$3\r\nfoo\r\n$3\r\nbar\r\n$2\r\n42\r\n$3\r\n1.5\r\n$1\r\n1\r\n"
+	if string(buf) != exp {
+		t.Fatalf("expected %q got %q", exp, buf)
+	}
+}
+
+func TestWriteReusesBuffer(t *testing.T) {
+	conn := newConnection(&discardConn{})
+	conn.Write("SET", "foo", "bar")
+	allocs := testing.AllocsPerRun(100, func() {
+		conn.Write("SET", "foo", "bar")
+	})
+	// the variadic arguments are the only allocation
+	if allocs > 1 {
+		t.Fatalf("was expecting at most one allocation but got %v", allocs)
+	}
+}
+
+// A net.Conn discarding writes.
+type discardConn struct{ faultConn }
+
+func (discardConn) Write(p []byte) (int, error) { return len(p), nil }
+
 func BenchmarkFormat(t *testing.B) {
+	t.ReportAllocs()
 	for i := 0; i < t.N; i++ {
 		format("SET", "foo", "bar")
 	}
 }
+
+func BenchmarkAppendCommand(b *testing.B) {
+	b.ReportAllocs()
+	args := []interface{}{"SET", "foo", "bar"}
+	var buf []byte
+	for i := 0; i < b.N; i++ {
+		buf, _ = appendCommand(buf[:0], args)
+	}
+}
+
+func BenchmarkAppendCommandInts(b *testing.B) {
+	b.ReportAllocs()
+	args := []interface{}{"ZADD", "zset", 1.5, "member", 42, "other"}
+	var buf []byte
+	for i := 0; i < b.N; i++ {
+		buf, _ = appendCommand(buf[:0], args)
+	}
+}
+
+func BenchmarkWriteBatch(b *testing.B) {
+	b.ReportAllocs()
+	conn := newConnection(&discardConn{})
+	cmds := [][]interface{}{{"SET", "foo", "bar"}, {"INCR", "counter"}, {"GET", "foo"}}
+	for i := 0; i < b.N; i++ {
+		conn.WriteBatch(cmds)
+	}
+}
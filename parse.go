@@ -2,15 +2,68 @@ package redis
 
 import (
 	"errors"
+	"fmt"
 	"github.com/daaku/go.redis/bufin"
 	"io"
+	"math/big"
 	"strconv"
 )
 
-var ErrProtocol = errors.New("go.redis: protocol error")
+var (
+	ErrProtocol = errors.New("go.redis: protocol error")
+
+	// ErrNilMultiBulk is returned for a nil multi-bulk reply, which is what
+	// the server sends for example when EXEC aborts because a WATCHed key
+	// changed.
+	ErrNilMultiBulk = errors.New("-MULTI-BULK: nil reply")
+)
+
+var (
+	// MaxBulkLen is the largest bulk string accepted in a reply, which is
+	// also the largest value Redis accepts. It should be set before any
+	// Client is used.
+	MaxBulkLen = 512 * 1024 * 1024
+
+	// MaxArrayLen is the largest number of elements accepted in an array,
+	// set or push reply, and of pairs in a map reply. It should be set
+	// before any Client is used.
+	MaxArrayLen = 64 * 1024 * 1024
+
+	// MaxLineLen is the largest line accepted in a reply, which limits the
+	// length of status and error replies. It should be set before any
+	// Client is used.
+	MaxLineLen = 64 * 1024
+)
+
+const (
+	// Maximum nesting of aggregate replies.
+	maxDepth = 64
+
+	// Bulk strings larger than this are allocated as they are read rather
+	// than all at once, so a bogus length can't exhaust memory.
+	bulkChunk = 64 * 1024
+)
+
+// ProtocolError describes a malformed reply. It matches ErrProtocol using
+// errors.Is.
+type ProtocolError struct {
+	Reason string
+}
+
+func protocolError(format string, args ...interface{}) *ProtocolError {
+	return &ProtocolError{Reason: fmt.Sprintf(format, args...)}
+}
+
+func (e *ProtocolError) Error() string {
+	return ErrProtocol.Error() + ": " + e.Reason
+}
+
+func (e *ProtocolError) Is(target error) bool {
+	return target == ErrProtocol
+}
 
 func (r *Reply) parseErr(res []byte) {
-	r.Err = errors.New(string(res))
+	r.Err = newRedisError(string(res))
 }
 
 func (r *Reply) parseStr(res []byte) {
@@ -20,75 +73,236 @@ func (r *Reply) parseStr(res []byte) {
 }
 
 func (r *Reply) parseInt(res []byte) {
-	b := make([]byte, len(res))
-	copy(b, res)
-	r.Elem = b
+	if _, err := strconv.ParseInt(string(res), 10, 64); err != nil {
+		r.Err = protocolError("invalid integer %q", res)
+		return
+	}
+	r.parseStr(res)
 }
 
-func (r *Reply) parseBulk(buf *bufin.Reader, res []byte) {
-	l, e := strconv.Atoi(string(res))
+func (r *Reply) parseDouble(res []byte) {
+	if _, err := strconv.ParseFloat(string(res), 64); err != nil {
+		r.Err = protocolError("invalid double %q", res)
+		return
+	}
+	r.parseStr(res)
+}
+
+func (r *Reply) parseBigNumber(res []byte) {
+	if _, ok := new(big.Int).SetString(string(res), 10); !ok {
+		r.Err = protocolError("invalid big number %q", res)
+		return
+	}
+	r.parseStr(res)
+}
+
+// Parse the length of a bulk string or aggregate, which may be -1 for nil.
+func parseLen(res []byte, max int) (int, error) {
+	l, err := strconv.Atoi(string(res))
+	if err != nil || l < -1 {
+		return 0, protocolError("invalid length %q", res)
+	}
+	if l > max {
+		return 0, protocolError("length %d exceeds the limit of %d", l, max)
+	}
+	return l, nil
+}
 
-	if e != nil {
-		// TODO: handle error
+func (r *Reply) parseBulk(buf *bufin.Reader, res []byte) {
+	l, err := parseLen(res, MaxBulkLen)
+	if err != nil {
+		r.Err = err
+		return
 	}
 
 	if l == -1 {
 		return
 	}
 
-	l += 2 // make sure to read \r\n
-	data := make([]byte, l)
-	n, err := io.ReadFull(buf, data)
+	data, err := readBulk(buf, l)
+	if err != nil {
+		r.Err = err
+		return
+	}
+
+	r.Elem = data
+}
+
+// Read a bulk string of the given length and the \r\n following it.
+func readBulk(buf *bufin.Reader, l int) ([]byte, error) {
+	var data []byte
+	if l+2 <= bulkChunk {
+		data = make([]byte, l+2)
+		if _, err := io.ReadFull(buf, data); err != nil {
+			return nil, unexpectedEOF(err)
+		}
+	} else {
+		// double the buffer as the data arrives, up to exactly its length
+		data = make([]byte, 0, bulkChunk)
+		for len(data) < l+2 {
+			if len(data) == cap(data) {
+				size := 2 * cap(data)
+				if size > l+2 {
+					size = l + 2
+				}
+				grown := make([]byte, len(data), size)
+				copy(grown, data)
+				data = grown
+			}
+			start := len(data)
+			data = data[:cap(data)]
+			if _, err := io.ReadFull(buf, data[start:]); err != nil {
+				return nil, unexpectedEOF(err)
+			}
+		}
+	}
+
+	if data[l] != cr || data[l+1] != lf {
+		return nil, protocolError("bulk string not terminated by CRLF")
+	}
+	return data[:l], nil
+}
+
+// A line which does not fit the buffer is longer than MaxLineLen.
+func lineError(err error) error {
+	if err == bufin.ErrFullBuf {
+		return protocolError("line exceeds the limit of %d bytes", MaxLineLen)
+	}
+	return err
+}
+
+// A reply cut short is never a clean end of the stream.
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+func (r *Reply) parseBlobErr(buf *bufin.Reader, res []byte) {
+	r.parseBulk(buf, res)
+	if r.Err == nil {
+		r.Err = newRedisError(string(r.Elem))
+		r.Elem = nil
+	}
+}
+
+func (r *Reply) parseVerbatim(buf *bufin.Reader, res []byte) {
+	r.parseBulk(buf, res)
+	if r.Err != nil {
+		return
+	}
+	// the format is exactly 3 bytes followed by a colon
+	if len(r.Elem) < 4 || r.Elem[3] != ':' {
+		r.Err = protocolError("invalid verbatim string format")
+		return
+	}
+	r.Format = string(r.Elem[:3])
+	r.Elem = r.Elem[4:]
+}
+
+func (r *Reply) parseBool(res []byte) {
+	if len(res) != 1 || (res[0] != 't' && res[0] != 'f') {
+		r.Err = protocolError("invalid boolean %q", res)
+		return
+	}
+	r.parseStr(res)
+}
 
-	// if we were unable to read all data from socket
-	if n != l && err == nil {
-		// TODO: handle error
+func (r *Reply) parseNull(res []byte) {
+	if len(res) != 0 {
+		r.Err = protocolError("invalid null %q", res)
 	}
+}
 
+// Maps and attributes are parsed into Elems as alternating keys and values,
+// the same way HGETALL returns a hash in RESP2.
+func (r *Reply) parseMap(buf *bufin.Reader, res []byte, depth int) {
+	l, err := parseLen(res, MaxArrayLen)
 	if err != nil {
 		r.Err = err
 		return
 	}
-
-	l -= 2
-	r.Elem = data[:l]
+	if l < 0 {
+		r.Err = protocolError("invalid map length %d", l)
+		return
+	}
+	r.parseElems(buf, l*2, depth)
 }
 
-func (r *Reply) parseMultiBulk(buf *bufin.Reader, res []byte) {
-	l, _ := strconv.Atoi(string(res))
+func (r *Reply) parseMultiBulk(buf *bufin.Reader, res []byte, depth int) {
+	l, err := parseLen(res, MaxArrayLen)
+	if err != nil {
+		r.Err = err
+		return
+	}
 
 	if l == -1 {
-		r.Err = errors.New("-MULTI-BULK: nil reply")
+		r.Err = ErrNilMultiBulk
+		return
+	}
+
+	r.parseElems(buf, l, depth)
+}
+
+func (r *Reply) parseElems(buf *bufin.Reader, l int, depth int) {
+	if depth >= maxDepth {
+		r.Err = protocolError("replies nested deeper than %d", maxDepth)
 		return
 	}
 
-	r.Elems = make([]*Reply, l)
+	// grow as the elements arrive rather than trusting the length
+	n := l
+	if n > 1024 {
+		n = 1024
+	}
+	r.Elems = make([]*Reply, 0, n)
 
 	for i := 0; i < l; i++ {
-		rr := parse(buf)
+		rr := parseDepth(buf, depth+1)
 
 		if rr.Err != nil {
 			r.Err = rr.Err
+
+			// the rest of the elements can't be read reliably
+			if !IsRedisError(rr.Err) && rr.Err != ErrNilMultiBulk {
+				return
+			}
 		}
 
-		r.Elems[i] = rr
+		r.Elems = append(r.Elems, rr)
 	}
-
-	// buffer is reduced to account for `nil` value returns
-	r.Elems = r.Elems[:l]
 }
 
 func parse(buf *bufin.Reader) *Reply {
-	r := new(Reply)
+	return parseDepth(buf, 0)
+}
+
+func parseDepth(buf *bufin.Reader, depth int) *Reply {
 	res, err := buf.ReadSlice(lf)
 
 	if err != nil {
-		r.Err = err
+		// the connection may be closed cleanly between replies
+		if depth > 0 {
+			err = unexpectedEOF(err)
+		}
+		return &Reply{Err: lineError(err)}
+	}
+
+	return parseLine(buf, res, depth)
+}
+
+// Parse the reply starting with the given header line.
+func parseLine(buf *bufin.Reader, res []byte, depth int) *Reply {
+	r := new(Reply)
+	if len(res) < 3 || res[len(res)-2] != cr {
+		r.Err = protocolError("line not terminated by CRLF")
 		return r
 	}
 
 	typ := res[0]
 	line := res[1 : len(res)-2]
+	r.Kind = Kind(typ)
 
 	switch typ {
 	case minus:
@@ -100,9 +314,40 @@ func parse(buf *bufin.Reader) *Reply {
 	case dollar:
 		r.parseBulk(buf, line)
 	case star:
-		r.parseMultiBulk(buf, line)
+		r.parseMultiBulk(buf, line, depth)
+	case percent:
+		r.parseMap(buf, line, depth)
+	case tilde, rangle:
+		r.parseMultiBulk(buf, line, depth)
+	case comma:
+		r.parseDouble(line)
+	case lparen:
+		r.parseBigNumber(line)
+	case hash:
+		r.parseBool(line)
+	case underscore:
+		r.parseNull(line)
+	case bang:
+		r.parseBlobErr(buf, line)
+	case equals:
+		r.parseVerbatim(buf, line)
+	case pipe:
+		// attributes are out of band data for the reply that follows
+		attrs := new(Reply)
+		attrs.Kind = KindAttribute
+		attrs.parseMap(buf, line, depth)
+		if attrs.Err != nil {
+			r.Err = attrs.Err
+			break
+		}
+		if depth+1 >= maxDepth {
+			r.Err = protocolError("replies nested deeper than %d", maxDepth)
+			break
+		}
+		r = parseDepth(buf, depth+1)
+		r.Attrs = attrs
 	default:
-		r.Err = ErrProtocol
+		r.Err = protocolError("unknown reply type %q", typ)
 	}
 
 	return r
@@ -0,0 +1,256 @@
+package redis
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/daaku/go.redis/bufin"
+)
+
+func parseTest(t *testing.T, in string) *Reply {
+	r := parse(bufin.NewReader(strings.NewReader(in)))
+	if r.Err != nil {
+		t.Fatalf("parse %q: unexpected error %s", in, r.Err)
+	}
+	return r
+}
+
+func TestParseRESP2(t *testing.T) {
+	if r := parseTest(t, "+OK\r\n"); r.Kind != KindStatus || r.Elem.String() != "OK" {
+		t.Errorf("unexpected status %+v", r)
+	}
+	if r := parseTest(t, ":42\r\n"); r.Kind != KindInt || r.Elem.Int() != 42 {
+		t.Errorf("unexpected int %+v", r)
+	}
+	if r := parseTest(t, "$3\r\nfoo\r\n"); r.Kind != KindBulk || r.Elem.String() != "foo" {
+		t.Errorf("unexpected bulk %+v", r)
+	}
+	if r := parseTest(t, "$-1\r\n"); !r.Nil() {
+		t.Errorf("unexpected nil bulk %+v", r)
+	}
+	r := parseTest(t, "*2\r\n$3\r\nfoo\r\n:1\r\n")
+	if r.Kind != KindArray || r.Len() != 2 || r.Elems[1].Elem.Int() != 1 {
+		t.Errorf("unexpected array %+v", r)
+	}
+	r = parse(bufin.NewReader(strings.NewReader("*-1\r\n")))
+	if r.Err != ErrNilMultiBulk {
+		t.Errorf("was expecting ErrNilMultiBulk but got %v", r.Err)
+	}
+	r = parse(bufin.NewReader(strings.NewReader("-ERR bad\r\n")))
+	if r.Err == nil || r.Err.Error() != "ERR bad" {
+		t.Errorf("unexpected error %v", r.Err)
+	}
+}
+
+func TestParseRESP3(t *testing.T) {
+	r := parseTest(t, "%2\r\n+a\r\n:1\r\n+b\r\n*1\r\n:2\r\n")
+	m := r.Map()
+	if r.Kind != KindMap || len(m) != 2 || m["a"].Elem.Int() != 1 || m["b"].Len() != 1 {
+		t.Errorf("unexpected map %+v", r)
+	}
+	if r := parseTest(t, "~2\r\n+a\r\n+b\r\n"); r.Kind != KindSet || r.Len() != 2 {
+		t.Errorf("unexpected set %+v", r)
+	}
+	if r := parseTest(t, ",3.14\r\n"); r.Kind != KindDouble || r.Elem.Float64() != 3.14 {
+		t.Errorf("unexpected double %+v", r)
+	}
+	if r := parseTest(t, "#t\r\n"); r.Kind != KindBool || !r.Elem.Bool() {
+		t.Errorf("unexpected bool %+v", r)
+	}
+	if r := parseTest(t, "#f\r\n"); r.Kind != KindBool || r.Elem.Bool() {
+		t.Errorf("unexpected bool %+v", r)
+	}
+	if r := parseTest(t, "_\r\n"); r.Kind != KindNull || !r.Nil() {
+		t.Errorf("unexpected null %+v", r)
+	}
+	r = parseTest(t, "(3492890328409238509324850943850943825024385\r\n")
+	if n, ok := r.BigInt(); r.Kind != KindBigNumber || !ok ||
+		n.String() != "3492890328409238509324850943850943825024385" {
+		t.Errorf("unexpected big number %+v", r)
+	}
+	r = parseTest(t, "=15\r\ntxt:Some string\r\n")
+	if r.Kind != KindVerbatim || r.Format != "txt" || r.Elem.String() != "Some string" {
+		t.Errorf("unexpected verbatim string %+v", r)
+	}
+	r = parseTest(t, "|1\r\n+ttl\r\n:3600\r\n$3\r\nfoo\r\n")
+	if r.Kind != KindBulk || r.Elem.String() != "foo" ||
+		r.Attrs == nil || r.Attrs.Map()["ttl"].Elem.Int() != 3600 {
+		t.Errorf("unexpected attributed reply %+v", r)
+	}
+	r = parseTest(t, ">3\r\n$7\r\nmessage\r\n$3\r\nfoo\r\n$3\r\nbar\r\n")
+	if m := r.Message(); r.Kind != KindPush || m == nil || m.Channel != "foo" {
+		t.Errorf("unexpected push %+v", r)
+	}
+	r = parse(bufin.NewReader(strings.NewReader("!8\r\nERR a\r\nb\r\n")))
+	if r.Err == nil || r.Err.Error() != "ERR a\r\nb" {
+		t.Errorf("unexpected blob error %v", r.Err)
+	}
+}
+
+func TestParseRedisError(t *testing.T) {
+	cases := map[string]RedisError{
+		"-ERR unknown command\r\n":      {Code: "ERR", Message: "unknown command"},
+		"-NOSCRIPT\r\n":                 {Code: "NOSCRIPT"},
+		"-no code here\r\n":             {Message: "no code here"},
+		"!11\r\nBUSY script\r\n":        {Code: "BUSY", Message: "script"},
+		"-LOADING Redis is loading\r\n": {Code: "LOADING", Message: "Redis is loading"},
+	}
+	for in, expected := range cases {
+		r := parse(bufin.NewReader(strings.NewReader(in)))
+		e, ok := r.Err.(*RedisError)
+		if !ok || *e != expected {
+			t.Errorf("parse %q: expected %#v got %#v", in, expected, r.Err)
+		}
+	}
+}
+
+func TestParseMalformed(t *testing.T) {
+	cases := []string{
+		"",
+		"\n",
+		"+OK\n",
+		"$3\r\nfoobar\r\n",
+		"$x\r\nfoo\r\n",
+		"$-2\r\n",
+		"*x\r\n",
+		"*-5\r\n",
+		"%-1\r\n",
+		":12a\r\n",
+		",pi\r\n",
+		"(12x\r\n",
+		"#x\r\n",
+		"_x\r\n",
+		"=3\r\ntxt\r\n",
+		"?what\r\n",
+		"*2\r\n:1\r\n",
+		"$10\r\nfoo",
+		"|1\r\n+a\r\n",
+	}
+	for _, in := range cases {
+		r := parse(bufin.NewReader(strings.NewReader(in)))
+		if r.Err == nil {
+			t.Errorf("parse %q: was expecting an error", in)
+		}
+	}
+}
+
+func TestParseProtocolError(t *testing.T) {
+	r := parse(bufin.NewReader(strings.NewReader("$3\r\nfoobar\r\n")))
+	var perr *ProtocolError
+	if !errors.Is(r.Err, ErrProtocol) || !errors.As(r.Err, &perr) ||
+		!strings.Contains(r.Err.Error(), "CRLF") {
+		t.Errorf("unexpected error %v", r.Err)
+	}
+	r = parse(bufin.NewReader(strings.NewReader("*2\r\n:1\r\n")))
+	if r.Err != io.ErrUnexpectedEOF {
+		t.Errorf("was expecting io.ErrUnexpectedEOF but got %v", r.Err)
+	}
+}
+
+func TestParseLimits(t *testing.T) {
+	defer func(bulk, array int) {
+		MaxBulkLen, MaxArrayLen = bulk, array
+	}(MaxBulkLen, MaxArrayLen)
+	MaxBulkLen, MaxArrayLen = 3, 2
+	parseTest(t, "$3\r\nfoo\r\n")
+	parseTest(t, "*2\r\n:1\r\n:2\r\n")
+	for _, in := range []string{"$4\r\nfoob\r\n", "*3\r\n", "%3\r\n", "$99999999999999999999\r\n"} {
+		r := parse(bufin.NewReader(strings.NewReader(in)))
+		if !errors.Is(r.Err, ErrProtocol) {
+			t.Errorf("parse %q: was expecting a protocol error but got %v", in, r.Err)
+		}
+	}
+
+	nested := strings.Repeat("*1\r\n", maxDepth+1) + ":1\r\n"
+	if r := parse(bufin.NewReader(strings.NewReader(nested))); !errors.Is(r.Err, ErrProtocol) {
+		t.Errorf("was expecting a protocol error for deep nesting but got %v", r.Err)
+	}
+}
+
+func TestParseLargeBulk(t *testing.T) {
+	value := strings.Repeat("x", bulkChunk*3+5)
+	r := parseTest(t, "$"+strconv.Itoa(len(value))+"\r\n"+value+"\r\n")
+	if r.Elem.String() != value {
+		t.Errorf("unexpected bulk of length %d", len(r.Elem))
+	}
+	if cap(r.Elem) != len(value)+2 {
+		t.Errorf("was expecting a capacity of %d but got %d", len(value)+2, cap(r.Elem))
+	}
+}
+
+func TestParseLongLine(t *testing.T) {
+	status := strings.Repeat("s", bufin.DefaultSize*4)
+	r := parseTest(t, "+"+status+"\r\n")
+	if r.Elem.String() != status {
+		t.Errorf("unexpected status of length %d", len(r.Elem))
+	}
+	message := strings.Repeat("m", bufin.DefaultSize*2)
+	r = parse(bufin.NewReader(strings.NewReader("-ERR " + message + "\r\n")))
+	if e, ok := r.Err.(*RedisError); !ok || e.Message != message {
+		t.Errorf("unexpected error %.40v", r.Err)
+	}
+
+	// a line without an end, as a broken peer might send
+	endless := "+" + strings.Repeat("s", bufin.DefaultMaxSize*2)
+	r = parse(bufin.NewReader(strings.NewReader(endless)))
+	if !errors.Is(r.Err, ErrProtocol) {
+		t.Errorf("was expecting a protocol error but got %.40v", r.Err)
+	}
+}
+
+// Replies as sent by Redis, covering each type.
+var parseSeeds = []string{
+	"+OK\r\n",
+	"-ERR unknown command 'FOO', with args beginning with: \r\n",
+	"-WRONGTYPE Operation against a key holding the wrong kind of value\r\n",
+	":1\r\n",
+	"$3\r\nbar\r\n",
+	"$-1\r\n",
+	"$0\r\n\r\n",
+	"*-1\r\n",
+	"*0\r\n",
+	"*3\r\n$7\r\nmessage\r\n$3\r\nfoo\r\n$3\r\nbar\r\n",
+	"*4\r\n$4\r\nname\r\n$3\r\nbob\r\n$3\r\nage\r\n$2\r\n42\r\n",
+	"*2\r\n*3\r\n:0\r\n:5460\r\n*3\r\n$9\r\n127.0.0.1\r\n:7000\r\n$40\r\n09dbe9720cda62f7865eabc5fd8857c5d2678366\r\n$1\r\n0\r\n",
+	"*3\r\n$1\r\na\r\n*-1\r\n-ERR x\r\n",
+	"%2\r\n$6\r\nserver\r\n$5\r\nredis\r\n$5\r\nproto\r\n:3\r\n",
+	"~2\r\n$1\r\na\r\n$1\r\nb\r\n",
+	">3\r\n$7\r\nmessage\r\n$3\r\nfoo\r\n$3\r\nbar\r\n",
+	",3.14\r\n",
+	",inf\r\n",
+	"#t\r\n",
+	"_\r\n",
+	"(3492890328409238509324850943850943825024385\r\n",
+	"=15\r\ntxt:Some string\r\n",
+	"!21\r\nSYNTAX invalid syntax\r\n",
+	"|1\r\n+key-popularity\r\n%2\r\n$1\r\na\r\n,0.1923\r\n$1\r\nb\r\n,0.0012\r\n*2\r\n:2039123\r\n:9543892\r\n",
+}
+
+func TestParseSeeds(t *testing.T) {
+	for _, in := range parseSeeds {
+		r := parse(bufin.NewReader(strings.NewReader(in)))
+		if r.Err != nil && !IsRedisError(r.Err) && r.Err != ErrNilMultiBulk {
+			t.Errorf("parse %q: unexpected error %s", in, r.Err)
+		}
+	}
+}
+
+func FuzzParse(f *testing.F) {
+	for _, s := range parseSeeds {
+		f.Add([]byte(s))
+	}
+	defer func(bulk, array int) {
+		MaxBulkLen, MaxArrayLen = bulk, array
+	}(MaxBulkLen, MaxArrayLen)
+	MaxBulkLen, MaxArrayLen = 1<<20, 1<<16
+	f.Fuzz(func(t *testing.T, data []byte) {
+		r := parse(bufin.NewReader(bytes.NewReader(data)))
+		if r == nil {
+			t.Fatal("nil reply")
+		}
+	})
+}
@@ -0,0 +1,118 @@
+package redis
+
+import (
+	"context"
+	"time"
+)
+
+// Pipeline queues commands and sends them to the server in one go, saving the
+// round trip per command that Call incurs. A Pipeline is not safe for
+// concurrent use.
+//
+//     p := client.Pipeline()
+//     p.Queue("SET", "foo", "bar")
+//     p.Queue("INCR", "counter")
+//     replies, err := p.Exec()
+type Pipeline struct {
+	client *Client
+	cmds   [][]interface{}
+}
+
+// Pipeline returns a new empty Pipeline for the Client.
+func (c *Client) Pipeline() *Pipeline {
+	return &Pipeline{client: c}
+}
+
+// Queue adds a command to the Pipeline. Nothing is sent until Exec.
+func (p *Pipeline) Queue(args ...interface{}) {
+	p.cmds = append(p.cmds, args)
+}
+
+// Len returns the number of queued commands.
+func (p *Pipeline) Len() int {
+	return len(p.cmds)
+}
+
+// Exec writes all the queued commands with a single write and returns their
+// replies in the order they were queued. An error returned by the server for
+// an individual command is reported in the Err field of its Reply, while the
+// returned error is reserved for failing to talk to the server at all. If the
+// connection breaks while reading, the replies which could not be read carry
+// the error as well. The Client Timeout applies to the Pipeline as a whole.
+// The Pipeline is empty once Exec returns and may be reused.
+func (p *Pipeline) Exec() ([]*Reply, error) {
+	return p.ExecContext(context.Background())
+}
+
+// ExecContext is like Exec, but honors the context the same way
+// Client.CallContext does.
+func (p *Pipeline) ExecContext(ctx context.Context) ([]*Reply, error) {
+	cmds := p.cmds
+	p.cmds = nil
+	if len(cmds) == 0 {
+		return nil, nil
+	}
+	return p.client.exec(ctx, cmds)
+}
+
+// Send the commands with a single write and read their replies.
+func (c *Client) exec(ctx context.Context, cmds [][]interface{}) (replies []*Reply, err error) {
+	start := time.Now()
+	conn, err := c.connect(ctx)
+	c.record(
+		"redis connection acquire", float64(time.Since(start).Nanoseconds()))
+	if err != nil {
+		c.inc("redis connection accquire error")
+		return nil, err
+	}
+	defer func() {
+		c.record(
+			"redis connection release", float64(time.Since(start).Nanoseconds()))
+		c.release(conn)
+	}()
+	err = c.setDeadlines(ctx, conn, c.readTimeout())
+	if err != nil {
+		c.inc("redis connection set deadline error")
+		return nil, err
+	}
+
+	if ctx.Done() != nil {
+		stop := c.watch(ctx, conn)
+		defer func() {
+			interrupted := stop()
+			if err != nil && (interrupted || expired(ctx)) {
+				c.inc("redis connection abandoned close")
+				c.discard(conn)
+				conn = nil
+				// the context may lag slightly behind its deadline
+				<-ctx.Done()
+				err = ctx.Err()
+			}
+		}()
+	}
+
+	err = conn.WriteBatch(cmds)
+	c.record("redis pipeline write", float64(time.Since(start).Nanoseconds()))
+	if err != nil {
+		c.inc("redis pipeline write error")
+		return nil, err
+	}
+	replies = make([]*Reply, len(cmds))
+	for i := range cmds {
+		reply, rerr := c.read(conn.connection)
+		if rerr != nil {
+			c.inc("redis pipeline read error")
+			if reply == nil {
+				reply = &Reply{Err: rerr}
+			}
+		}
+		replies[i] = reply
+	}
+	c.record("redis pipeline read", float64(time.Since(start).Nanoseconds()))
+	c.record("redis pipeline size", float64(len(cmds)))
+	// the connection broke while reading
+	if err = conn.Err(); err != nil {
+		return replies, err
+	}
+	return replies, nil
+}
@@ -0,0 +1,108 @@
+package redis_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/daaku/go.redis"
+	"github.com/daaku/go.redis/redistest"
+)
+
+func TestPipeline(t *testing.T) {
+	server, client := redistest.NewServerClient(t)
+	defer server.Close()
+	p := client.Pipeline()
+	p.Queue("SET", "foo", "bar")
+	p.Queue("INCR", "foo")
+	p.Queue("GET", "foo")
+	if p.Len() != 3 {
+		t.Fatalf("was expecting 3 queued commands but got %d", p.Len())
+	}
+	replies, err := p.Exec()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(replies) != 3 {
+		t.Fatalf("was expecting 3 replies but got %d", len(replies))
+	}
+	if replies[0].Err != nil {
+		t.Fatal(replies[0].Err)
+	}
+	if replies[1].Err == nil {
+		t.Fatal("was expecting INCR on a string to fail")
+	}
+	if replies[2].Err != nil || replies[2].Elem.String() != "bar" {
+		t.Fatalf("was expecting bar but got %v", replies[2])
+	}
+	if p.Len() != 0 {
+		t.Fatal("was expecting pipeline to be empty after Exec")
+	}
+}
+
+func TestPipelineEmpty(t *testing.T) {
+	server, client := redistest.NewServerClient(t)
+	defer server.Close()
+	replies, err := client.Pipeline().Exec()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if replies != nil {
+		t.Fatalf("was expecting no replies but got %v", replies)
+	}
+}
+
+func TestPipelineBrokenRead(t *testing.T) {
+	node := newFakeNode(t)
+	defer node.Close()
+	node.Handle(func(cmd, prev []string) string {
+		if cmd[0] == "GET" {
+			return "?bad\r\n"
+		}
+		return "+OK\r\n"
+	})
+	client := &redis.Client{
+		Proto:    "tcp",
+		Addr:     node.Addr(),
+		PoolSize: 1,
+		Timeout:  time.Second,
+	}
+	defer client.Close()
+	p := client.Pipeline()
+	p.Queue("SET", "foo", "bar")
+	p.Queue("GET", "foo")
+	replies, err := p.Exec()
+	if !errors.Is(err, redis.ErrProtocol) {
+		t.Fatalf("was expecting a protocol error but got %v", err)
+	}
+	if len(replies) != 2 || replies[0].Err != nil || replies[1].Err == nil {
+		t.Fatalf("unexpected replies %v", replies)
+	}
+}
+
+func TestPipelineExecContext(t *testing.T) {
+	server, client := redistest.NewServerClient(t)
+	defer server.Close()
+	client = &redis.Client{
+		Proto:    client.Proto,
+		Addr:     client.Addr,
+		PoolSize: 1,
+		Timeout:  time.Second,
+	}
+	defer client.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	p := client.Pipeline()
+	p.Queue("PING")
+	p.Queue("BLPOP", "list", 0)
+	if _, err := p.ExecContext(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("was expecting context.DeadlineExceeded but got %v", err)
+	}
+	if stats := client.PoolStats(); stats.Total != 0 || stats.InUse != 0 {
+		t.Fatalf("was expecting the connection to be closed but got %+v", stats)
+	}
+	if _, err := client.Call("PING"); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,292 @@
+package redis
+
+import (
+	"context"
+	"time"
+)
+
+// The reaper checks for stale connections at least this far apart.
+const minReapInterval = time.Millisecond
+
+// PoolStats is a snapshot of the connection pool of a Client.
+type PoolStats struct {
+	Total        uint          // Open connections
+	Idle         uint          // Open connections waiting in the pool
+	InUse        uint          // Open connections currently in use
+	WaitCount    uint64        // Number of times a call had to wait for a connection
+	WaitDuration time.Duration // Total time spent waiting for a connection
+	Timeouts     uint64        // Number of times waiting for a connection was given up
+}
+
+// A connection in the pool, along with the bookkeeping for health checks.
+type pooledConn struct {
+	*connection
+	created time.Time
+	used    time.Time
+}
+
+// Create the pool, and start the reaper if stale connections are to be
+// closed.
+func (c *Client) init() error {
+	c.once.Do(func() {
+		if c.PoolSize == 0 {
+			c.initErr = errPoolSizeNotSpecified
+			return
+		}
+		c.pool = make(chan *pooledConn, c.PoolSize)
+		c.done = make(chan struct{})
+		var i uint
+		for i = 0; i < c.PoolSize; i++ {
+			c.pool <- nil
+		}
+		if c.IdleTimeout > 0 || c.MaxConnAge > 0 {
+			go c.reaper()
+		}
+	})
+	return c.initErr
+}
+
+// Pop a connection from the pool or create a fresh one. If an error is
+// returned the connection must not be released.
+func (c *Client) connect(ctx context.Context) (conn *pooledConn, err error) {
+	if err := c.init(); err != nil {
+		return nil, err
+	}
+	if c.isClosed() {
+		return nil, ErrClientClosed
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	select {
+	case conn = <-c.pool:
+	default:
+		start := time.Now()
+		var timeout <-chan time.Time
+		if c.PoolTimeout > 0 {
+			timer := time.NewTimer(c.PoolTimeout)
+			defer timer.Stop()
+			timeout = timer.C
+		}
+		select {
+		case conn = <-c.pool:
+		case <-ctx.Done():
+			c.waited(start, true)
+			return nil, ctx.Err()
+		case <-timeout:
+			c.inc("redis connection pool timeout")
+			c.waited(start, true)
+			return nil, ErrPoolTimeout
+		case <-c.done:
+			return nil, ErrClientClosed
+		}
+		c.waited(start, false)
+	}
+	if c.isClosed() {
+		if conn != nil {
+			c.closeConn(conn)
+		}
+		c.pool <- nil
+		return nil, ErrClientClosed
+	}
+	if conn != nil {
+		now := time.Now()
+		if c.stale(conn, now) {
+			c.inc("redis connection stale close")
+			c.closeConn(conn)
+			conn = nil
+		} else if c.TestOnBorrow > 0 && now.Sub(conn.used) > c.TestOnBorrow {
+			if err := c.ping(conn.connection); err != nil {
+				c.inc("redis connection test on borrow close")
+				c.closeConn(conn)
+				conn = nil
+			}
+		}
+	}
+	if conn == nil {
+		fresh, err := c.dial(ctx)
+		if err != nil {
+			c.pool <- nil
+			// the dial error only says it was canceled
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			return nil, err
+		}
+		now := time.Now()
+		conn = &pooledConn{connection: fresh, created: now, used: now}
+		c.mu.Lock()
+		c.poolStats.Total++
+		c.mu.Unlock()
+	}
+	c.mu.Lock()
+	c.poolStats.InUse++
+	c.mu.Unlock()
+	return conn, nil
+}
+
+// Push a connection back into the pool, closing it first if it is no longer
+// usable.
+func (c *Client) release(conn *pooledConn) {
+	if conn != nil {
+		c.mu.Lock()
+		c.poolStats.InUse--
+		closed := c.closed
+		c.mu.Unlock()
+		if conn.Err() != nil {
+			c.inc("redis connection error close")
+			c.closeConn(conn)
+			conn = nil
+		} else if closed {
+			c.closeConn(conn)
+			conn = nil
+		} else {
+			conn.used = time.Now()
+		}
+	}
+	c.pool <- conn
+}
+
+// Close a connection in use instead of releasing it. Its place in the pool
+// must still be released.
+func (c *Client) discard(conn *pooledConn) {
+	c.mu.Lock()
+	c.poolStats.InUse--
+	c.mu.Unlock()
+	c.closeConn(conn)
+}
+
+// Close a connection which came from the pool.
+func (c *Client) closeConn(conn *pooledConn) {
+	conn.Close()
+	c.mu.Lock()
+	c.poolStats.Total--
+	c.mu.Unlock()
+}
+
+// Record having waited for a connection.
+func (c *Client) waited(start time.Time, timeout bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.poolStats.WaitCount++
+	c.poolStats.WaitDuration += time.Since(start)
+	if timeout {
+		c.poolStats.Timeouts++
+	}
+}
+
+func (c *Client) isClosed() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.closed
+}
+
+// PoolStats returns a snapshot of the connection pool statistics.
+func (c *Client) PoolStats() PoolStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s := c.poolStats
+	s.Idle = s.Total - s.InUse
+	return s
+}
+
+// Close the Client. Idle connections are closed immediately, and connections
+// in use as soon as they are released. Calls made after Close fail with
+// ErrClientClosed.
+func (c *Client) Close() error {
+	c.init()
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil
+	}
+	c.closed = true
+	c.mu.Unlock()
+	if c.done != nil {
+		close(c.done)
+	}
+	c.closeIdle()
+	return nil
+}
+
+// Check if a connection is too old or has been idle for too long.
+func (c *Client) stale(conn *pooledConn, now time.Time) bool {
+	if c.IdleTimeout > 0 && now.Sub(conn.used) > c.IdleTimeout {
+		return true
+	}
+	if c.MaxConnAge > 0 && now.Sub(conn.created) > c.MaxConnAge {
+		return true
+	}
+	return false
+}
+
+// Check if a connection is still alive.
+func (c *Client) ping(conn *connection) error {
+	err := c.setDeadlines(context.Background(), conn, c.readTimeout())
+	if err != nil {
+		return err
+	}
+	if err = conn.Write("PING"); err != nil {
+		return err
+	}
+	_, err = c.read(conn)
+	return err
+}
+
+// Periodically close stale idle connections.
+func (c *Client) reaper() {
+	interval := c.IdleTimeout
+	if interval == 0 || (c.MaxConnAge > 0 && c.MaxConnAge < interval) {
+		interval = c.MaxConnAge
+	}
+	interval /= 2
+	if interval < minReapInterval {
+		interval = minReapInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-c.done:
+			return
+		}
+		now := time.Now()
+		c.reap(func(conn *pooledConn) bool {
+			return c.stale(conn, now)
+		})
+	}
+}
+
+// Close the connections currently idle in the pool for which the function
+// returns true. Connections in use are unaffected.
+func (c *Client) reap(close func(*pooledConn) bool) {
+	if c.pool == nil {
+		return
+	}
+	var idle []*pooledConn
+	var i uint
+	for i = 0; i < c.PoolSize; i++ {
+		select {
+		case conn := <-c.pool:
+			if conn != nil && close(conn) {
+				c.inc("redis connection reap close")
+				c.closeConn(conn)
+				conn = nil
+			}
+			idle = append(idle, conn)
+			continue
+		default:
+		}
+		break
+	}
+	for _, conn := range idle {
+		c.pool <- conn
+	}
+}
+
+// Close the connections currently idle in the pool. Connections in use are
+// unaffected and return to the pool as usual.
+func (c *Client) closeIdle() {
+	c.reap(func(*pooledConn) bool { return true })
+}
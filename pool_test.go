@@ -0,0 +1,202 @@
+package redis_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/daaku/go.redis"
+	"github.com/daaku/go.redis/redistest"
+)
+
+// Stats counting the calls to Inc.
+type countStats struct {
+	mu     sync.Mutex
+	counts map[string]int
+}
+
+func (s *countStats) Inc(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.counts == nil {
+		s.counts = make(map[string]int)
+	}
+	s.counts[name]++
+}
+
+func (s *countStats) Record(name string, value float64) {}
+
+func (s *countStats) Count(name string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.counts[name]
+}
+
+func newPoolClient(server *redistest.Server) (*redis.Client, *countStats) {
+	stats := &countStats{}
+	return &redis.Client{
+		Proto:    server.Proto(),
+		Addr:     server.Addr(),
+		PoolSize: 1,
+		Timeout:  time.Second,
+		Stats:    stats,
+	}, stats
+}
+
+func restart(t *testing.T, server *redistest.Server) {
+	server.Command.Process.Kill()
+	server.Command.Wait()
+	if err := server.Start(); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond)
+}
+
+func TestIdleTimeoutReaper(t *testing.T) {
+	server, _ := redistest.NewServerClient(t)
+	defer server.Close()
+	client, stats := newPoolClient(server)
+	client.IdleTimeout = 20 * time.Millisecond
+	defer client.Close()
+	if _, err := client.Call("PING"); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(60 * time.Millisecond)
+	if stats.Count("redis connection reap close") != 1 {
+		t.Fatal("was expecting the idle connection to be reaped")
+	}
+	if _, err := client.Call("PING"); err != nil {
+		t.Fatal(err)
+	}
+	if stats.Count("redis connection new") != 2 {
+		t.Fatal("was expecting a new connection")
+	}
+}
+
+func TestTinyIdleTimeout(t *testing.T) {
+	server, _ := redistest.NewServerClient(t)
+	defer server.Close()
+	client, _ := newPoolClient(server)
+	client.IdleTimeout = time.Nanosecond
+	client.MaxConnAge = time.Nanosecond
+	defer client.Close()
+	for i := 0; i < 3; i++ {
+		if _, err := client.Call("PING"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	time.Sleep(5 * time.Millisecond)
+}
+
+func TestMaxConnAge(t *testing.T) {
+	server, _ := redistest.NewServerClient(t)
+	defer server.Close()
+	client, stats := newPoolClient(server)
+	client.MaxConnAge = time.Hour
+	defer client.Close()
+	for i := 0; i < 3; i++ {
+		if _, err := client.Call("PING"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if stats.Count("redis connection new") != 1 {
+		t.Fatal("was expecting the connection to be reused")
+	}
+}
+
+func TestTestOnBorrow(t *testing.T) {
+	server, _ := redistest.NewServerClient(t)
+	defer server.Close()
+	client, stats := newPoolClient(server)
+	client.TestOnBorrow = time.Nanosecond
+	defer client.Close()
+	if _, err := client.Call("PING"); err != nil {
+		t.Fatal(err)
+	}
+	// the pooled connection is now dead, as if dropped by a load balancer
+	restart(t, server)
+	if _, err := client.Call("PING"); err != nil {
+		t.Fatal(err)
+	}
+	if stats.Count("redis connection test on borrow close") != 1 {
+		t.Fatal("was expecting the dead connection to be detected")
+	}
+}
+
+func TestClientClose(t *testing.T) {
+	server, _ := redistest.NewServerClient(t)
+	defer server.Close()
+	client, _ := newPoolClient(server)
+	client.PoolSize = 2
+	if _, err := client.Call("PING"); err != nil {
+		t.Fatal(err)
+	}
+	_, err := client.Transaction(func(tx *redis.Tx) error {
+		// one connection is pinned by the transaction
+		if _, err := client.Call("PING"); err != nil {
+			return err
+		}
+		stats := client.PoolStats()
+		if stats.Total != 2 || stats.InUse != 1 || stats.Idle != 1 {
+			t.Fatalf("unexpected stats %+v", stats)
+		}
+		return client.Close()
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats := client.PoolStats(); stats.Total != 0 || stats.InUse != 0 {
+		t.Fatalf("was expecting all connections to be closed but got %+v", stats)
+	}
+	if _, err := client.Call("PING"); err != redis.ErrClientClosed {
+		t.Fatalf("was expecting ErrClientClosed but got %v", err)
+	}
+	if err := client.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPoolStatsWait(t *testing.T) {
+	server, _ := redistest.NewServerClient(t)
+	defer server.Close()
+	client, _ := newPoolClient(server)
+	defer client.Close()
+	_, err := client.Transaction(func(tx *redis.Tx) error {
+		ctx, cancel := context.WithTimeout(
+			context.Background(), 10*time.Millisecond)
+		defer cancel()
+		client.CallContext(ctx, "PING")
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stats := client.PoolStats()
+	if stats.WaitCount != 1 || stats.Timeouts != 1 || stats.WaitDuration == 0 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+}
+
+func TestPoolTimeout(t *testing.T) {
+	server, _ := redistest.NewServerClient(t)
+	defer server.Close()
+	client, stats := newPoolClient(server)
+	client.PoolTimeout = 10 * time.Millisecond
+	defer client.Close()
+	_, err := client.Transaction(func(tx *redis.Tx) error {
+		if _, err := client.Call("PING"); err != redis.ErrPoolTimeout {
+			t.Fatalf("was expecting ErrPoolTimeout but got %v", err)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := stats.Count("redis connection pool timeout"); n != 1 {
+		t.Fatalf("was expecting 1 pool timeout but got %d", n)
+	}
+	if s := client.PoolStats(); s.Timeouts != 1 {
+		t.Fatalf("unexpected stats %+v", s)
+	}
+}
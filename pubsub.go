@@ -0,0 +1,303 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+const (
+	// Buffer length of the Messages and Confirmations channels.
+	subBufferLen = 64
+
+	// Delay between attempts to reconnect a Subscription.
+	subReconnectDelay = 100 * time.Millisecond
+)
+
+// ErrSubscriptionClosed is returned when using a closed Subscription.
+var ErrSubscriptionClosed = errors.New("go.redis: subscription closed")
+
+// Confirmation is sent by the server in response to SUBSCRIBE, PSUBSCRIBE,
+// UNSUBSCRIBE and PUNSUBSCRIBE.
+type Confirmation struct {
+	Kind    string // One of "subscribe", "psubscribe", "unsubscribe" or "punsubscribe"
+	Channel string // The channel or pattern
+	Count   int    // Number of channels and patterns still subscribed to
+}
+
+// Subscription holds a dedicated connection in subscribed state and delivers
+// the published messages on the Messages channel. If the connection breaks, a
+// new one is established and all channels and patterns are subscribed to
+// again. Messages published in the meantime are lost.
+type Subscription struct {
+	// Messages receives the published messages. It is closed once the
+	// Subscription is closed.
+	Messages <-chan *Message
+
+	// Confirmations receives the subscribe and unsubscribe confirmations.
+	// Confirmations are dropped if the channel is full, so it only needs to be
+	// drained if they are of interest.
+	Confirmations <-chan *Confirmation
+
+	client        *Client
+	messages      chan *Message
+	confirmations chan *Confirmation
+	done          chan struct{}
+
+	broken func() // called when the connection breaks, before reconnecting
+
+	mu       sync.Mutex
+	conn     *connection
+	channels map[string]bool
+	patterns map[string]bool
+	closed   bool
+}
+
+// Subscribe returns a Subscription to the given channels.
+func (c *Client) Subscribe(channels ...string) (*Subscription, error) {
+	return c.subscribe(nil, channels)
+}
+
+// Subscribe to the channels, calling broken whenever the connection breaks.
+func (c *Client) subscribe(broken func(), channels []string) (*Subscription, error) {
+	s, err := c.subscription(broken)
+	if err != nil {
+		return nil, err
+	}
+	if len(channels) > 0 {
+		if err := s.Subscribe(channels...); err != nil {
+			s.Close()
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// PSubscribe returns a Subscription to the given patterns.
+func (c *Client) PSubscribe(patterns ...string) (*Subscription, error) {
+	s, err := c.subscription(nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(patterns) > 0 {
+		if err := s.PSubscribe(patterns...); err != nil {
+			s.Close()
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+func (c *Client) subscription(broken func()) (*Subscription, error) {
+	conn, err := c.dial(context.Background())
+	if err != nil {
+		c.inc("redis subscription dial error")
+		return nil, err
+	}
+	s := &Subscription{
+		client:        c,
+		broken:        broken,
+		conn:          conn,
+		messages:      make(chan *Message, subBufferLen),
+		confirmations: make(chan *Confirmation, subBufferLen),
+		done:          make(chan struct{}),
+		channels:      make(map[string]bool),
+		patterns:      make(map[string]bool),
+	}
+	s.Messages = s.messages
+	s.Confirmations = s.confirmations
+	go s.run(conn)
+	return s, nil
+}
+
+// Subscribe adds channels to the Subscription.
+func (s *Subscription) Subscribe(channels ...string) error {
+	return s.command("SUBSCRIBE", s.channels, true, channels)
+}
+
+// PSubscribe adds patterns to the Subscription.
+func (s *Subscription) PSubscribe(patterns ...string) error {
+	return s.command("PSUBSCRIBE", s.patterns, true, patterns)
+}
+
+// Unsubscribe removes channels from the Subscription. If no channels are
+// given, all channels are removed.
+func (s *Subscription) Unsubscribe(channels ...string) error {
+	return s.command("UNSUBSCRIBE", s.channels, false, channels)
+}
+
+// PUnsubscribe removes patterns from the Subscription. If no patterns are
+// given, all patterns are removed.
+func (s *Subscription) PUnsubscribe(patterns ...string) error {
+	return s.command("PUNSUBSCRIBE", s.patterns, false, patterns)
+}
+
+// Close the Subscription and its connection. Messages not yet received are
+// discarded and the Messages channel is closed.
+func (s *Subscription) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	close(s.done)
+	return s.conn.Close()
+}
+
+// Send a command and record the change to the set of channels or patterns
+// so it can be replayed after reconnecting.
+func (s *Subscription) command(name string, set map[string]bool, add bool, names []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return ErrSubscriptionClosed
+	}
+	if add {
+		for _, n := range names {
+			set[n] = true
+		}
+	} else if len(names) == 0 {
+		for n := range set {
+			delete(set, n)
+		}
+	} else {
+		for _, n := range names {
+			delete(set, n)
+		}
+	}
+	err := s.write(name, names)
+	if err != nil {
+		// the reader will notice the broken connection and resubscribe
+		s.client.inc("redis subscription write error")
+	}
+	return err
+}
+
+// Write a command to the current connection. Must be called with s.mu held.
+func (s *Subscription) write(name string, names []string) error {
+	args := make([]interface{}, 0, len(names)+1)
+	args = append(args, name)
+	for _, n := range names {
+		args = append(args, n)
+	}
+	err := s.conn.Sock().SetWriteDeadline(
+		deadline(context.Background(), time.Now(), s.client.writeTimeout()))
+	if err != nil {
+		return err
+	}
+	return s.conn.Write(args...)
+}
+
+// Read replies from conn until it breaks, and then reconnect. This is the
+// only goroutine reading from the connection.
+func (s *Subscription) run(conn *connection) {
+	defer close(s.messages)
+	for {
+		reply, err := conn.Read()
+		if err == nil {
+			s.dispatch(reply)
+			continue
+		}
+		if conn.Err() == nil {
+			// a server error, like one for a bad pattern
+			s.client.inc("redis subscription server error")
+			continue
+		}
+		conn.Close()
+		if s.broken != nil {
+			s.broken()
+		}
+		if conn = s.reconnect(); conn == nil {
+			return
+		}
+	}
+}
+
+// Deliver a reply to the right channel.
+func (s *Subscription) dispatch(reply *Reply) {
+	if m := reply.Message(); m != nil {
+		select {
+		case s.messages <- m:
+		case <-s.done:
+		}
+		return
+	}
+	if len(reply.Elems) != 3 {
+		return
+	}
+	kind := reply.Elems[0].Elem.String()
+	switch kind {
+	case "subscribe", "psubscribe", "unsubscribe", "punsubscribe":
+		c := &Confirmation{
+			Kind:    kind,
+			Channel: reply.Elems[1].Elem.String(),
+			Count:   reply.Elems[2].Elem.Int(),
+		}
+		select {
+		case s.confirmations <- c:
+		default:
+		}
+	}
+}
+
+// Dial until a connection is established and all channels and patterns are
+// subscribed to again. Returns nil if the Subscription or the Client is
+// closed.
+func (s *Subscription) reconnect() *connection {
+	for {
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			return nil
+		}
+		s.mu.Unlock()
+
+		s.client.inc("redis subscription reconnect")
+		conn, err := s.client.dial(context.Background())
+		if err == ErrClientClosed {
+			return nil
+		}
+		if err == nil {
+			s.mu.Lock()
+			if s.closed {
+				s.mu.Unlock()
+				conn.Close()
+				return nil
+			}
+			s.conn = conn
+			err = s.resubscribe()
+			s.mu.Unlock()
+			if err == nil {
+				return conn
+			}
+			conn.Close()
+		}
+		time.Sleep(subReconnectDelay)
+	}
+}
+
+// Replay the channels and patterns on the current connection. Must be called
+// with s.mu held.
+func (s *Subscription) resubscribe() error {
+	if len(s.channels) > 0 {
+		if err := s.write("SUBSCRIBE", keys(s.channels)); err != nil {
+			return err
+		}
+	}
+	if len(s.patterns) > 0 {
+		if err := s.write("PSUBSCRIBE", keys(s.patterns)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func keys(set map[string]bool) []string {
+	l := make([]string, 0, len(set))
+	for k := range set {
+		l = append(l, k)
+	}
+	return l
+}
@@ -0,0 +1,144 @@
+package redis_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/daaku/go.redis"
+	"github.com/daaku/go.redis/redistest"
+)
+
+func receive(t *testing.T, sub *redis.Subscription) *redis.Message {
+	select {
+	case m := <-sub.Messages:
+		return m
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for message")
+	}
+	return nil
+}
+
+func confirm(t *testing.T, sub *redis.Subscription, kind, channel string) {
+	select {
+	case c := <-sub.Confirmations:
+		if c.Kind != kind || c.Channel != channel {
+			t.Fatalf("was expecting %s %s but got %s %s",
+				kind, channel, c.Kind, c.Channel)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for confirmation")
+	}
+}
+
+func TestSubscribe(t *testing.T) {
+	server, client := redistest.NewServerClient(t)
+	defer server.Close()
+	sub, err := client.Subscribe("foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Close()
+	confirm(t, sub, "subscribe", "foo")
+	if _, err := client.Call("PUBLISH", "foo", "bar"); err != nil {
+		t.Fatal(err)
+	}
+	m := receive(t, sub)
+	if m.Channel != "foo" || m.Elem.String() != "bar" {
+		t.Fatalf("unexpected message %+v", m)
+	}
+
+	if err := sub.PSubscribe("b*"); err != nil {
+		t.Fatal(err)
+	}
+	confirm(t, sub, "psubscribe", "b*")
+	if _, err := client.Call("PUBLISH", "baz", "qux"); err != nil {
+		t.Fatal(err)
+	}
+	m = receive(t, sub)
+	if m.Pattern != "b*" || m.Channel != "baz" || m.Elem.String() != "qux" {
+		t.Fatalf("unexpected message %+v", m)
+	}
+
+	if err := sub.Unsubscribe("foo"); err != nil {
+		t.Fatal(err)
+	}
+	confirm(t, sub, "unsubscribe", "foo")
+}
+
+func TestSubscriptionClose(t *testing.T) {
+	server, client := redistest.NewServerClient(t)
+	defer server.Close()
+	sub, err := client.Subscribe("foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sub.Close()
+	select {
+	case _, ok := <-sub.Messages:
+		if ok {
+			t.Fatal("was not expecting a message")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for close")
+	}
+	if err := sub.Subscribe("bar"); err != redis.ErrSubscriptionClosed {
+		t.Fatalf("was expecting ErrSubscriptionClosed but got %v", err)
+	}
+}
+
+func TestSubscriptionReconnect(t *testing.T) {
+	server, client := redistest.NewServerClient(t)
+	defer server.Close()
+	sub, err := client.Subscribe("foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Close()
+	confirm(t, sub, "subscribe", "foo")
+
+	server.Command.Process.Kill()
+	server.Command.Wait()
+	if err := server.Start(); err != nil {
+		t.Fatal(err)
+	}
+	confirm(t, sub, "subscribe", "foo")
+
+	publisher := &redis.Client{
+		Proto:    server.Proto(),
+		Addr:     server.Addr(),
+		PoolSize: 1,
+		Timeout:  time.Second,
+	}
+	if _, err := publisher.Call("PUBLISH", "foo", "bar"); err != nil {
+		t.Fatal(err)
+	}
+	m := receive(t, sub)
+	if m.Channel != "foo" || m.Elem.String() != "bar" {
+		t.Fatalf("unexpected message %+v", m)
+	}
+}
+
+func TestSubscribeIdleWithSetup(t *testing.T) {
+	server, _ := redistest.NewServerClient(t)
+	defer server.Close()
+	client, stats := newPoolClient(server)
+	client.Timeout = 50 * time.Millisecond
+	client.ClientName = "subscriber"
+	defer client.Close()
+	sub, err := client.Subscribe("foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Close()
+	confirm(t, sub, "subscribe", "foo")
+	time.Sleep(200 * time.Millisecond)
+	if n := stats.Count("redis subscription reconnect"); n != 0 {
+		t.Fatalf("was expecting no reconnects while idle but got %d", n)
+	}
+	if _, err := client.Call("PUBLISH", "foo", "bar"); err != nil {
+		t.Fatal(err)
+	}
+	if m := receive(t, sub); m.Elem.String() != "bar" {
+		t.Fatalf("unexpected message %+v", m)
+	}
+}
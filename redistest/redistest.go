@@ -18,6 +18,7 @@ type Server struct {
 	Command *exec.Cmd
 	Port    int
 	T       Fatalf
+	clients []*redis.Client
 }
 
 type Fatalf interface {
@@ -58,6 +59,7 @@ func NewServerClient(t Fatalf) (*Server, *redis.Client) {
 		}
 		t.Fatalf("err %s", err)
 	}
+	server.clients = append(server.clients, client)
 	return server, client
 }
 
@@ -92,6 +94,11 @@ func (s *Server) Start() error {
 	return nil
 }
 
+// Close kills the server and closes the clients created using
+// NewServerClient.
 func (s *Server) Close() error {
+	for _, c := range s.clients {
+		c.Close()
+	}
 	return s.Command.Process.Kill()
 }
@@ -1,19 +1,49 @@
 package redis
 
 import (
+	"math/big"
 	"strconv"
 	"strings"
 )
 
 type Elem []byte
 
+// Kind identifies the protocol type a Reply was parsed from.
+type Kind byte
+
+const (
+	KindError     Kind = '-'
+	KindStatus    Kind = '+'
+	KindInt       Kind = ':'
+	KindBulk      Kind = '$'
+	KindArray     Kind = '*'
+	KindMap       Kind = '%' // RESP3
+	KindSet       Kind = '~' // RESP3
+	KindDouble    Kind = ',' // RESP3
+	KindBool      Kind = '#' // RESP3
+	KindNull      Kind = '_' // RESP3
+	KindBigNumber Kind = '(' // RESP3
+	KindVerbatim  Kind = '=' // RESP3
+	KindBlobError Kind = '!' // RESP3
+	KindAttribute Kind = '|' // RESP3
+	KindPush      Kind = '>' // RESP3
+)
+
 type Reply struct {
 	Err   error
 	Elem  Elem
-	Elems []*Reply
+	Elems []*Reply // Maps hold alternating keys and values
+	Kind  Kind
+
+	// Format of a verbatim string, like "txt" or "mkd"
+	Format string
+
+	// Attributes sent along with the reply, as a map
+	Attrs *Reply
 }
 
 type Message struct {
+	Pattern string // The matched pattern for messages from PSUBSCRIBE
 	Channel string
 	Elem    Elem
 }
@@ -46,6 +76,33 @@ func (e Elem) Float64() float64 {
 	return v
 }
 
+// ParseBool is like Bool but returns ErrNil for a nil Elem and the strconv
+// error if the Elem is not a boolean.
+func (e Elem) ParseBool() (bool, error) {
+	if e == nil {
+		return false, ErrNil
+	}
+	return strconv.ParseBool(e.String())
+}
+
+// ParseInt is like Int64 but returns ErrNil for a nil Elem and the strconv
+// error if the Elem is not an integer.
+func (e Elem) ParseInt() (int64, error) {
+	if e == nil {
+		return 0, ErrNil
+	}
+	return strconv.ParseInt(e.String(), 10, 64)
+}
+
+// ParseFloat is like Float64 but returns ErrNil for a nil Elem and the strconv
+// error if the Elem is not a number.
+func (e Elem) ParseFloat() (float64, error) {
+	if e == nil {
+		return 0, ErrNil
+	}
+	return strconv.ParseFloat(e.String(), 64)
+}
+
 func (r *Reply) Nil() bool {
 	return r.Elems == nil && r.Elem == nil && r.Err == nil
 }
@@ -89,6 +146,84 @@ func (r *Reply) IntArray() []int64 {
 	return buf
 }
 
+// Check that the reply holds an array, optionally of an even length.
+func (r *Reply) checkArray(even bool) error {
+	if r.Err != nil {
+		return r.Err
+	}
+	if r.Nil() {
+		return ErrNil
+	}
+	if r.Elems == nil || (even && len(r.Elems)%2 == 1) {
+		return ErrUnexpectedReply
+	}
+	return nil
+}
+
+// Int64s is like IntArray but returns ErrNil for a nil reply,
+// ErrUnexpectedReply if the reply is not an array, and the error from
+// Elem.ParseInt if an element is not an integer.
+func (r *Reply) Int64s() ([]int64, error) {
+	if err := r.checkArray(false); err != nil {
+		return nil, err
+	}
+	buf := make([]int64, len(r.Elems))
+
+	for i, v := range r.Elems {
+		n, err := v.Elem.ParseInt()
+		if err != nil {
+			return nil, err
+		}
+		buf[i] = n
+	}
+
+	return buf, nil
+}
+
+// Float64s returns an array reply as floats, failing the same way as Int64s.
+func (r *Reply) Float64s() ([]float64, error) {
+	if err := r.checkArray(false); err != nil {
+		return nil, err
+	}
+	buf := make([]float64, len(r.Elems))
+
+	for i, v := range r.Elems {
+		f, err := v.Elem.ParseFloat()
+		if err != nil {
+			return nil, err
+		}
+		buf[i] = f
+	}
+
+	return buf, nil
+}
+
+// Strings is like StringArray but returns ErrNil for a nil reply and
+// ErrUnexpectedReply if the reply is not an array.
+func (r *Reply) Strings() ([]string, error) {
+	if err := r.checkArray(false); err != nil {
+		return nil, err
+	}
+	return r.StringArray(), nil
+}
+
+// StringMapE is like StringMap but returns ErrNil for a nil reply and
+// ErrUnexpectedReply if the reply is not an array of even length.
+func (r *Reply) StringMapE() (map[string]string, error) {
+	if err := r.checkArray(true); err != nil {
+		return nil, err
+	}
+	return r.StringMap(), nil
+}
+
+// HashE is like Hash but fails the same way as StringMapE.
+func (r *Reply) HashE() (map[string]Elem, error) {
+	if err := r.checkArray(true); err != nil {
+		return nil, err
+	}
+	return r.Hash(), nil
+}
+
 func (r *Reply) StringMap() map[string]string {
 	arr := r.StringArray()
 	n := len(arr)
@@ -123,6 +258,29 @@ func (r *Reply) Hash() map[string]Elem {
 	return h
 }
 
+// Map returns a map or an array of alternating keys and values as a map of
+// replies. Unlike Hash it supports nested replies as values.
+func (r *Reply) Map() map[string]*Reply {
+	l := r.Len()
+	m := make(map[string]*Reply, l/2)
+
+	if l%2 == 1 {
+		return m
+	}
+
+	for i := 0; i < l; i += 2 {
+		m[r.Elems[i].Elem.String()] = r.Elems[i+1]
+	}
+
+	return m
+}
+
+// BigInt returns a big number reply. Doubles are returned using Elem.Float64,
+// and booleans, sent as "t" or "f", using Elem.Bool.
+func (r *Reply) BigInt() (*big.Int, bool) {
+	return new(big.Int).SetString(r.Elem.String(), 10)
+}
+
 func (r *Reply) Message() *Message {
 	if len(r.Elems) < 3 {
 		return nil
@@ -132,9 +290,19 @@ func (r *Reply) Message() *Message {
 
 	switch typ {
 	case "message":
-		return &Message{r.Elems[1].Elem.String(), r.Elems[2].Elem}
+		return &Message{
+			Channel: r.Elems[1].Elem.String(),
+			Elem:    r.Elems[2].Elem,
+		}
 	case "pmessage":
-		return &Message{r.Elems[2].Elem.String(), r.Elems[3].Elem}
+		if len(r.Elems) < 4 {
+			return nil
+		}
+		return &Message{
+			Pattern: r.Elems[1].Elem.String(),
+			Channel: r.Elems[2].Elem.String(),
+			Elem:    r.Elems[3].Elem,
+		}
 	}
 
 	if strings.HasSuffix(typ, "subscribe") {
@@ -0,0 +1,71 @@
+package redis
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestElemParse(t *testing.T) {
+	if n, err := Elem("42").ParseInt(); err != nil || n != 42 {
+		t.Errorf("was expecting 42 but got %d %v", n, err)
+	}
+	if _, err := Elem(nil).ParseInt(); err != ErrNil {
+		t.Errorf("was expecting ErrNil but got %v", err)
+	}
+	if _, err := Elem("4x").ParseInt(); err == nil {
+		t.Error("was expecting a parse error")
+	} else if _, ok := err.(*strconv.NumError); !ok {
+		t.Errorf("was expecting a *strconv.NumError but got %T", err)
+	}
+	if f, err := Elem("1.5").ParseFloat(); err != nil || f != 1.5 {
+		t.Errorf("was expecting 1.5 but got %f %v", f, err)
+	}
+	if _, err := Elem("").ParseFloat(); err == nil {
+		t.Error("was expecting a parse error for an empty elem")
+	}
+	if b, err := Elem("1").ParseBool(); err != nil || !b {
+		t.Errorf("was expecting true but got %v %v", b, err)
+	}
+	if _, err := Elem("maybe").ParseBool(); err == nil {
+		t.Error("was expecting a parse error")
+	}
+}
+
+func array(elems ...string) *Reply {
+	r := &Reply{Kind: KindArray, Elems: make([]*Reply, len(elems))}
+	for i, e := range elems {
+		r.Elems[i] = &Reply{Kind: KindBulk, Elem: Elem(e)}
+	}
+	return r
+}
+
+func TestReplyChecked(t *testing.T) {
+	if n, err := array("1", "2").Int64s(); err != nil || len(n) != 2 || n[1] != 2 {
+		t.Errorf("unexpected ints %v %v", n, err)
+	}
+	if _, err := array("1", "x").Int64s(); err == nil {
+		t.Error("was expecting a parse error")
+	}
+	if _, err := new(Reply).Int64s(); err != ErrNil {
+		t.Errorf("was expecting ErrNil but got %v", err)
+	}
+	status := &Reply{Kind: KindStatus, Elem: Elem("OK")}
+	if _, err := status.Strings(); err != ErrUnexpectedReply {
+		t.Errorf("was expecting ErrUnexpectedReply but got %v", err)
+	}
+	if f, err := array("1.5").Float64s(); err != nil || f[0] != 1.5 {
+		t.Errorf("unexpected floats %v %v", f, err)
+	}
+	if m, err := array("a", "b").StringMapE(); err != nil || m["a"] != "b" {
+		t.Errorf("unexpected map %v %v", m, err)
+	}
+	if _, err := array("a", "b", "c").StringMapE(); err != ErrUnexpectedReply {
+		t.Errorf("was expecting ErrUnexpectedReply but got %v", err)
+	}
+	if _, err := array("a").HashE(); err != ErrUnexpectedReply {
+		t.Errorf("was expecting ErrUnexpectedReply but got %v", err)
+	}
+	if h, err := array().HashE(); err != nil || len(h) != 0 {
+		t.Errorf("unexpected hash %v %v", h, err)
+	}
+}
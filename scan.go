@@ -0,0 +1,248 @@
+package redis
+
+import (
+	"encoding"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var (
+	// ErrNotStructPointer is returned by ScanStruct when not given a pointer
+	// to a struct.
+	ErrNotStructPointer = errors.New("go.redis: destination is not a struct pointer")
+
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+	textMarshalerType   = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// Scan copies the elements of an array reply into the values pointed at by
+// dest, in order. The number of elements must match the number of
+// destinations. Strings, byte slices, integers, floats, bools and types
+// implementing encoding.TextUnmarshaler, such as time.Time, are supported, as
+// well as pointers to those which are set to nil for nil elements. Other
+// destinations are left alone for nil elements.
+//
+//     var name string
+//     var age int
+//     reply, err := client.Call("HMGET", "user:1", "name", "age")
+//     err = reply.Scan(&name, &age)
+func (r *Reply) Scan(dest ...interface{}) error {
+	if err := r.checkArray(false); err != nil {
+		return err
+	}
+	if len(r.Elems) != len(dest) {
+		return ErrUnexpectedReply
+	}
+	for i, d := range dest {
+		v := reflect.ValueOf(d)
+		if v.Kind() != reflect.Ptr || v.IsNil() {
+			return fmt.Errorf("go.redis: scan destination %d is not a pointer", i)
+		}
+		if err := scanElem(r.Elems[i].Elem, v.Elem()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ScanStruct copies the field and value pairs of a hash reply, such as the
+// one from HGETALL, into the fields of the struct pointed at by dest. Field
+// names are taken from the redis struct tag, and default to the name of the
+// field. Fields tagged with "-" and pairs without a matching field are
+// ignored. The field types supported are the same as for Scan.
+//
+//     type User struct {
+//         Name    string    `redis:"name"`
+//         Age     int       `redis:"age"`
+//         Updated time.Time `redis:"updated"`
+//     }
+//
+//     var u User
+//     reply, err := client.Call("HGETALL", "user:1")
+//     err = reply.ScanStruct(&u)
+func (r *Reply) ScanStruct(dest interface{}) error {
+	if err := r.checkArray(true); err != nil {
+		return err
+	}
+	v := reflect.ValueOf(dest)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return ErrNotStructPointer
+	}
+	v = v.Elem()
+	fields := structFields(v.Type())
+	for i := 0; i < len(r.Elems); i += 2 {
+		index, ok := fields[r.Elems[i].Elem.String()]
+		if !ok {
+			continue
+		}
+		if err := scanElem(r.Elems[i+1].Elem, v.Field(index)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Store an element in the value, converting it as necessary.
+func scanElem(e Elem, v reflect.Value) error {
+	if v.Kind() == reflect.Ptr {
+		if e == nil {
+			v.Set(reflect.Zero(v.Type()))
+			return nil
+		}
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return scanElem(e, v.Elem())
+	}
+	if e == nil {
+		return nil
+	}
+	if v.CanAddr() && v.Addr().Type().Implements(textUnmarshalerType) {
+		return scanError(e, v, v.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText(e))
+	}
+
+	var err error
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(string(e))
+	case reflect.Slice:
+		if v.Type().Elem().Kind() != reflect.Uint8 {
+			return scanError(e, v, errors.New("unsupported type"))
+		}
+		v.SetBytes(append([]byte(nil), e...))
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		var n int64
+		n, err = strconv.ParseInt(string(e), 10, v.Type().Bits())
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		var n uint64
+		n, err = strconv.ParseUint(string(e), 10, v.Type().Bits())
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		var f float64
+		f, err = strconv.ParseFloat(string(e), v.Type().Bits())
+		v.SetFloat(f)
+	case reflect.Bool:
+		var b bool
+		b, err = strconv.ParseBool(string(e))
+		v.SetBool(b)
+	case reflect.Interface:
+		if v.NumMethod() != 0 {
+			return scanError(e, v, errors.New("unsupported type"))
+		}
+		v.Set(reflect.ValueOf(append([]byte(nil), e...)))
+	default:
+		return scanError(e, v, errors.New("unsupported type"))
+	}
+	return scanError(e, v, err)
+}
+
+func scanError(e Elem, v reflect.Value, err error) error {
+	if err == nil {
+		return nil
+	}
+	return fmt.Errorf("go.redis: cannot scan %q into %s: %w", e, v.Type(), err)
+}
+
+// Field indexes by name, cached by struct type.
+var fieldCache sync.Map // map[reflect.Type]map[string]int
+
+func structFields(t reflect.Type) map[string]int {
+	if f, ok := fieldCache.Load(t); ok {
+		return f.(map[string]int)
+	}
+	fields := make(map[string]int, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		if name, ok := fieldName(t.Field(i)); ok {
+			fields[name] = i
+		}
+	}
+	fieldCache.Store(t, fields)
+	return fields
+}
+
+// Returns the name of an exported field from the redis tag or the field name,
+// unless the tag is "-".
+func fieldName(f reflect.StructField) (string, bool) {
+	if f.PkgPath != "" {
+		return "", false
+	}
+	tag := f.Tag.Get("redis")
+	switch tag {
+	case "":
+		return f.Name, true
+	case "-":
+		return "", false
+	}
+	return strings.Split(tag, ",")[0], true
+}
+
+// Args builds the arguments of a command.
+//
+//     args := redis.Args{"HSET", "user:1"}.AddFlat(&user)
+//     reply, err := client.Call(args...)
+type Args []interface{}
+
+// Add appends the values as is.
+func (a Args) Add(values ...interface{}) Args {
+	return append(a, values...)
+}
+
+// AddFlat appends a struct as alternating field names and values, using the
+// same names as ScanStruct. Nil pointer fields are skipped, and values
+// implementing encoding.TextMarshaler, such as time.Time, are marshaled. Maps
+// are appended as alternating keys and values, and slices as their elements.
+// Other values are appended as is.
+func (a Args) AddFlat(v interface{}) Args {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Ptr && !rv.IsNil() && rv.Elem().Kind() == reflect.Struct {
+		rv = rv.Elem()
+	}
+	switch rv.Kind() {
+	case reflect.Struct:
+		t := rv.Type()
+		for i := 0; i < t.NumField(); i++ {
+			name, ok := fieldName(t.Field(i))
+			if !ok {
+				continue
+			}
+			fv := rv.Field(i)
+			if fv.Kind() == reflect.Ptr {
+				if fv.IsNil() {
+					continue
+				}
+				fv = fv.Elem()
+			}
+			a = append(a, name, flatValue(fv))
+		}
+	case reflect.Map:
+		iter := rv.MapRange()
+		for iter.Next() {
+			a = append(a, flatValue(iter.Key()), flatValue(iter.Value()))
+		}
+	case reflect.Slice:
+		if rv.Type().Elem().Kind() == reflect.Uint8 {
+			return append(a, v)
+		}
+		for i := 0; i < rv.Len(); i++ {
+			a = append(a, flatValue(rv.Index(i)))
+		}
+	default:
+		a = append(a, v)
+	}
+	return a
+}
+
+// Returns the value to send for a struct field, map entry or slice element.
+func flatValue(v reflect.Value) interface{} {
+	if v.Type().Implements(textMarshalerType) {
+		if text, err := v.Interface().(encoding.TextMarshaler).MarshalText(); err == nil {
+			return text
+		}
+	}
+	return v.Interface()
+}
@@ -0,0 +1,102 @@
+package redis_test
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/daaku/go.redis"
+	"github.com/daaku/go.redis/redistest"
+)
+
+type scanUser struct {
+	Name    string    `redis:"name"`
+	Age     int       `redis:"age"`
+	Score   float64   `redis:"score"`
+	Admin   bool      `redis:"admin"`
+	Updated time.Time `redis:"updated"`
+	Nick    *string   `redis:"nick"`
+	Ignored string    `redis:"-"`
+	Raw     []byte
+}
+
+func TestReplyScanStruct(t *testing.T) {
+	server, client := redistest.NewServerClient(t)
+	defer server.Close()
+	nick := "ally"
+	in := scanUser{
+		Name:    "alice",
+		Age:     42,
+		Score:   1.5,
+		Admin:   true,
+		Updated: time.Date(2020, 1, 2, 3, 4, 5, 6, time.UTC),
+		Nick:    &nick,
+		Ignored: "ignored",
+		Raw:     []byte("raw"),
+	}
+	args := redis.Args{"HSET", "user"}.AddFlat(&in)
+	if len(args) != 16 {
+		t.Fatalf("unexpected args %q", args)
+	}
+	if _, err := client.Call(args...); err != nil {
+		t.Fatal(err)
+	}
+	reply, err := client.Call("HGETALL", "user")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out scanUser
+	if err := reply.ScanStruct(&out); err != nil {
+		t.Fatal(err)
+	}
+	in.Ignored = ""
+	if !reflect.DeepEqual(in, out) {
+		t.Fatalf("was expecting %+v but got %+v", in, out)
+	}
+	if err := reply.ScanStruct(out); err != redis.ErrNotStructPointer {
+		t.Fatalf("was expecting ErrNotStructPointer but got %v", err)
+	}
+}
+
+func TestReplyScan(t *testing.T) {
+	server, client := redistest.NewServerClient(t)
+	defer server.Close()
+	if _, err := client.Call("HSET", "user", "name", "bob", "age", "x"); err != nil {
+		t.Fatal(err)
+	}
+	reply, err := client.Call("HMGET", "user", "name", "missing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var name string
+	missing := new(int)
+	if err := reply.Scan(&name, &missing); err != nil {
+		t.Fatal(err)
+	}
+	if name != "bob" || missing != nil {
+		t.Fatalf("unexpected values %q %v", name, missing)
+	}
+	if err := reply.Scan(&name); err != redis.ErrUnexpectedReply {
+		t.Fatalf("was expecting ErrUnexpectedReply but got %v", err)
+	}
+
+	reply, err = client.Call("HMGET", "user", "age")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var age int
+	if err := reply.Scan(&age); err == nil {
+		t.Fatal("was expecting an error scanning a string into an int")
+	}
+}
+
+func TestAddFlat(t *testing.T) {
+	args := redis.Args{"HSET", "h"}.AddFlat(map[string]int{"a": 1})
+	if !reflect.DeepEqual(args, redis.Args{"HSET", "h", "a", 1}) {
+		t.Fatalf("unexpected args %q", args)
+	}
+	args = redis.Args{"SADD", "s"}.AddFlat([]string{"a", "b"}).Add("c")
+	if !reflect.DeepEqual(args, redis.Args{"SADD", "s", "a", "b", "c"}) {
+		t.Fatalf("unexpected args %q", args)
+	}
+}
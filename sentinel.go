@@ -0,0 +1,349 @@
+package redis
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"math/rand"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrMasterNotFound is returned when none of the sentinels could provide the
+// address of a master which confirms its role.
+var ErrMasterNotFound = errors.New("go.redis: master not found using sentinels")
+
+// SentinelClient talks to the master of a Redis deployment monitored by
+// Sentinel. The master is discovered by asking the sentinels, and followed
+// across failovers by listening for +switch-master events, at which point the
+// connection pool of the old master is drained and one for the new master is
+// created.
+type SentinelClient struct {
+	Sentinels  []string      // Sentinel addresses like "127.0.0.1:26379"
+	MasterName string        // Name of the monitored master
+	PoolSize   uint          // Connection Pool Size, must be specified
+	Timeout    time.Duration // Timeout per call
+	Stats      Stats         // For Stats collection
+	Protocol   int           // Protocol version, 3 sends HELLO 3 on connect
+
+	Username   string // ACL user to authenticate to the master and replicas as
+	Password   string // Password to authenticate to the master and replicas with
+	DB         int    // Database to select on the master and replicas
+	ClientName string // Name to set on new connections
+
+	SentinelUsername string // ACL user to authenticate to the sentinels as
+	SentinelPassword string // Password to authenticate to the sentinels with
+
+	// TLSConfig enables TLS for the connections to the sentinels, the master
+	// and the replicas.
+	TLSConfig *tls.Config
+
+	// Dialer opens the connections instead of dialing the address using TCP.
+	// The context expires after the timeout.
+	Dialer func(ctx context.Context, addr string) (net.Conn, error)
+
+	mu          sync.Mutex
+	master      *Client
+	replicas    []*Client
+	sub         *Subscription
+	discovering bool
+}
+
+func (s *SentinelClient) inc(name string) {
+	if s.Stats != nil {
+		s.Stats.Inc(name)
+	}
+}
+
+// Call sends the command to the current master.
+func (s *SentinelClient) Call(args ...interface{}) (*Reply, error) {
+	return s.CallContext(context.Background(), args...)
+}
+
+// CallContext is like Call, but honors the context the same way
+// Client.CallContext does.
+func (s *SentinelClient) CallContext(ctx context.Context, args ...interface{}) (*Reply, error) {
+	master, err := s.Master()
+	if err != nil {
+		return nil, err
+	}
+	reply, err := master.CallContext(ctx, args...)
+	if err == ErrClientClosed {
+		// the master was switched after we got it
+		if master, err = s.Master(); err != nil {
+			return nil, err
+		}
+		reply, err = master.CallContext(ctx, args...)
+	}
+	if err != nil && s.stale(err) {
+		s.rediscover()
+	}
+	return reply, err
+}
+
+// CallReplica sends the command to a random replica of the master, or to the
+// master itself if no replica is available. Replicas may lag behind the
+// master, so this is only suitable for reads which can tolerate that.
+func (s *SentinelClient) CallReplica(args ...interface{}) (*Reply, error) {
+	client, err := s.replica()
+	if err != nil {
+		return nil, err
+	}
+	reply, err := client.Call(args...)
+	if err == ErrClientClosed {
+		// the replica was switched after we picked it
+		if client, err = s.replica(); err != nil {
+			return nil, err
+		}
+		reply, err = client.Call(args...)
+	}
+	return reply, err
+}
+
+// Pick a random replica, or the master if there are none.
+func (s *SentinelClient) replica() (*Client, error) {
+	if _, err := s.Master(); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.replicas) > 0 {
+		return s.replicas[rand.Intn(len(s.replicas))], nil
+	}
+	return s.master, nil
+}
+
+// Master returns the Client for the current master, discovering it if
+// necessary.
+func (s *SentinelClient) Master() (*Client, error) {
+	s.mu.Lock()
+	master := s.master
+	s.mu.Unlock()
+	if master != nil {
+		return master, nil
+	}
+	if err := s.discover(); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.master, nil
+}
+
+// Close stops listening for failovers and closes the master and replica
+// clients.
+func (s *SentinelClient) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.master != nil {
+		s.master.Close()
+	}
+	for _, r := range s.replicas {
+		r.Close()
+	}
+	if s.sub == nil {
+		return nil
+	}
+	err := s.sub.Close()
+	s.sub = nil
+	return err
+}
+
+// Errors indicating the master we know of is no longer the master.
+func (s *SentinelClient) stale(err error) bool {
+	if _, ok := err.(net.Error); ok {
+		return true
+	}
+	return IsReadOnly(err)
+}
+
+// Discover the master again in the background.
+func (s *SentinelClient) rediscover() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.discovering {
+		return
+	}
+	s.discovering = true
+	go func() {
+		s.inc("redis sentinel rediscover")
+		s.discover()
+		s.mu.Lock()
+		s.discovering = false
+		s.mu.Unlock()
+	}()
+}
+
+// Ask each sentinel in turn for the master, and switch to it once it confirms
+// its role.
+func (s *SentinelClient) discover() error {
+	for _, addr := range s.Sentinels {
+		sentinel := s.sentinel(addr)
+		reply, err := sentinel.Call(
+			"SENTINEL", "get-master-addr-by-name", s.MasterName)
+		if err != nil || reply.Len() != 2 {
+			s.inc("redis sentinel query error")
+			sentinel.closeIdle()
+			continue
+		}
+		master := net.JoinHostPort(
+			reply.Elems[0].Elem.String(), reply.Elems[1].Elem.String())
+		if !s.isMaster(master) {
+			s.inc("redis sentinel role mismatch")
+			sentinel.closeIdle()
+			continue
+		}
+		s.switchMaster(master, s.replicaAddrs(sentinel))
+		s.watch(sentinel)
+		sentinel.closeIdle()
+		return nil
+	}
+	return ErrMasterNotFound
+}
+
+// Check the ROLE of a node.
+func (s *SentinelClient) isMaster(addr string) bool {
+	client := s.client(addr)
+	defer client.Close()
+	reply, err := client.Call("ROLE")
+	if err != nil || reply.Len() == 0 {
+		return false
+	}
+	return reply.Elems[0].Elem.String() == "master"
+}
+
+// Returns the addresses of the healthy replicas known to the sentinel.
+func (s *SentinelClient) replicaAddrs(sentinel *Client) []string {
+	reply, err := sentinel.Call("SENTINEL", "replicas", s.MasterName)
+	if err != nil {
+		return nil
+	}
+	var addrs []string
+	for _, r := range reply.Elems {
+		info := r.Map()
+		ip, port, flags := info["ip"], info["port"], info["flags"]
+		if ip == nil || port == nil || flags == nil {
+			continue
+		}
+		f := flags.Elem.String()
+		if strings.Contains(f, "s_down") || strings.Contains(f, "o_down") ||
+			strings.Contains(f, "disconnected") {
+			continue
+		}
+		addrs = append(addrs, net.JoinHostPort(ip.Elem.String(), port.Elem.String()))
+	}
+	return addrs
+}
+
+// Start following +switch-master events from the sentinel, unless we already
+// are.
+func (s *SentinelClient) watch(sentinel *Client) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.sub != nil {
+		return
+	}
+	var sub *Subscription
+	sub, err := sentinel.subscribe(func() { s.lost(sub) }, []string{"+switch-master"})
+	if err != nil {
+		s.inc("redis sentinel subscribe error")
+		return
+	}
+	s.sub = sub
+	go func() {
+		for m := range sub.Messages {
+			// <master name> <old ip> <old port> <new ip> <new port>
+			parts := strings.Fields(m.Elem.String())
+			if len(parts) != 5 || parts[0] != s.MasterName {
+				continue
+			}
+			s.inc("redis sentinel switch master")
+			addr := net.JoinHostPort(parts[3], parts[4])
+			s.switchMaster(addr, s.replicaAddrs(sentinel))
+			sentinel.closeIdle()
+		}
+	}()
+}
+
+// The connection to the sentinel we follow broke. Stop following it and
+// discover the master again, which follows the first sentinel that answers.
+func (s *SentinelClient) lost(sub *Subscription) {
+	s.mu.Lock()
+	if s.sub != sub {
+		s.mu.Unlock()
+		return
+	}
+	s.sub = nil
+	s.mu.Unlock()
+	s.inc("redis sentinel lost")
+	sub.Close()
+	s.rediscover()
+}
+
+// Replace the master and replica clients whose address changed. The old
+// clients are closed, which lets the calls in progress finish.
+func (s *SentinelClient) switchMaster(addr string, replicas []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.master == nil || s.master.Addr != addr {
+		if s.master != nil {
+			s.master.Close()
+		}
+		s.master = s.client(addr)
+	}
+	old := make(map[string]*Client, len(s.replicas))
+	for _, r := range s.replicas {
+		old[r.Addr] = r
+	}
+	s.replicas = make([]*Client, 0, len(replicas))
+	for _, r := range replicas {
+		client, ok := old[r]
+		if ok {
+			delete(old, r)
+		} else {
+			client = s.client(r)
+		}
+		s.replicas = append(s.replicas, client)
+	}
+	for _, r := range old {
+		r.Close()
+	}
+}
+
+// Returns a Client for the master or a replica.
+func (s *SentinelClient) client(addr string) *Client {
+	client := s.newClient(addr)
+	client.Username = s.Username
+	client.Password = s.Password
+	client.DB = s.DB
+	return client
+}
+
+// Returns a Client for a sentinel.
+func (s *SentinelClient) sentinel(addr string) *Client {
+	client := s.newClient(addr)
+	client.Username = s.SentinelUsername
+	client.Password = s.SentinelPassword
+	return client
+}
+
+func (s *SentinelClient) newClient(addr string) *Client {
+	client := &Client{
+		Addr:       addr,
+		Proto:      "tcp",
+		PoolSize:   s.PoolSize,
+		Timeout:    s.Timeout,
+		Stats:      s.Stats,
+		Protocol:   s.Protocol,
+		ClientName: s.ClientName,
+		TLSConfig:  s.TLSConfig,
+	}
+	if dialer := s.Dialer; dialer != nil {
+		client.Dialer = func(ctx context.Context) (net.Conn, error) {
+			return dialer(ctx, addr)
+		}
+	}
+	return client
+}
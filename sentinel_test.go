@@ -0,0 +1,281 @@
+package redis_test
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/daaku/go.redis"
+)
+
+func bulk(s string) string {
+	return fmt.Sprintf("$%d\r\n%s\r\n", len(s), s)
+}
+
+// A fake master answering ROLE, and GET with its own address.
+func newFakeMaster(t *testing.T, role string) *fakeNode {
+	n := newFakeNode(t)
+	n.Handle(func(cmd, prev []string) string {
+		if cmd[0] == "ROLE" {
+			return "*3\r\n" + bulk(role) + ":0\r\n*0\r\n"
+		}
+		return bulk(n.Addr())
+	})
+	return n
+}
+
+// A fake sentinel pointing at the master returned by the function.
+func newFakeSentinel(t *testing.T, master func() string, replica string) *fakeNode {
+	n := newFakeNode(t)
+	n.Handle(func(cmd, prev []string) string {
+		switch {
+		case cmd[0] == "SUBSCRIBE":
+			return "*3\r\n" + bulk("subscribe") + bulk(cmd[1]) + ":1\r\n"
+		case cmd[0] == "SENTINEL" && cmd[1] == "get-master-addr-by-name":
+			host, port, _ := net.SplitHostPort(master())
+			return "*2\r\n" + bulk(host) + bulk(port)
+		case cmd[0] == "SENTINEL" && cmd[1] == "replicas":
+			if replica == "" {
+				return "*0\r\n"
+			}
+			host, port, _ := net.SplitHostPort(replica)
+			return "*1\r\n*6\r\n" + bulk("ip") + bulk(host) + bulk("port") +
+				bulk(port) + bulk("flags") + bulk("slave")
+		}
+		return "-ERR unknown command\r\n"
+	})
+	return n
+}
+
+func newSentinelClient(sentinels ...string) *redis.SentinelClient {
+	return &redis.SentinelClient{
+		Sentinels:  sentinels,
+		MasterName: "mymaster",
+		PoolSize:   2,
+		Timeout:    time.Second,
+	}
+}
+
+func callAddr(t *testing.T, call func(...interface{}) (*redis.Reply, error)) string {
+	reply, err := call("GET", "foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return reply.Elem.String()
+}
+
+func TestSentinelSwitchMaster(t *testing.T) {
+	a, b := newFakeMaster(t, "master"), newFakeMaster(t, "master")
+	defer a.Close()
+	defer b.Close()
+	var mu sync.Mutex
+	current := a.Addr()
+	sentinel := newFakeSentinel(t, func() string {
+		mu.Lock()
+		defer mu.Unlock()
+		return current
+	}, "")
+	defer sentinel.Close()
+
+	client := newSentinelClient(sentinel.Addr())
+	defer client.Close()
+	if addr := callAddr(t, client.Call); addr != a.Addr() {
+		t.Fatalf("was expecting %s but got %s", a.Addr(), addr)
+	}
+
+	mu.Lock()
+	current = b.Addr()
+	mu.Unlock()
+	ahost, aport, _ := net.SplitHostPort(a.Addr())
+	bhost, bport, _ := net.SplitHostPort(b.Addr())
+	msg := fmt.Sprintf("mymaster %s %s %s %s", ahost, aport, bhost, bport)
+	sentinel.Send("*3\r\n" + bulk("message") + bulk("+switch-master") + bulk(msg))
+
+	deadline := time.Now().Add(time.Second)
+	for callAddr(t, client.Call) != b.Addr() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for master switch")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestSentinelRoleMismatch(t *testing.T) {
+	replica, master := newFakeMaster(t, "slave"), newFakeMaster(t, "master")
+	defer replica.Close()
+	defer master.Close()
+	stale := newFakeSentinel(t, replica.Addr, "")
+	defer stale.Close()
+	good := newFakeSentinel(t, master.Addr, "")
+	defer good.Close()
+
+	client := newSentinelClient(stale.Addr(), good.Addr())
+	defer client.Close()
+	if addr := callAddr(t, client.Call); addr != master.Addr() {
+		t.Fatalf("was expecting %s but got %s", master.Addr(), addr)
+	}
+}
+
+func TestSentinelMasterNotFound(t *testing.T) {
+	replica := newFakeMaster(t, "slave")
+	defer replica.Close()
+	sentinel := newFakeSentinel(t, replica.Addr, "")
+	defer sentinel.Close()
+	client := newSentinelClient(sentinel.Addr())
+	if _, err := client.Call("GET", "foo"); err != redis.ErrMasterNotFound {
+		t.Fatalf("was expecting ErrMasterNotFound but got %v", err)
+	}
+}
+
+func TestSentinelReplica(t *testing.T) {
+	master, replica := newFakeMaster(t, "master"), newFakeMaster(t, "slave")
+	defer master.Close()
+	defer replica.Close()
+	sentinel := newFakeSentinel(t, master.Addr, replica.Addr())
+	defer sentinel.Close()
+	client := newSentinelClient(sentinel.Addr())
+	defer client.Close()
+	if addr := callAddr(t, client.CallReplica); addr != replica.Addr() {
+		t.Fatalf("was expecting %s but got %s", replica.Addr(), addr)
+	}
+}
+
+func TestSentinelSwitchKeepsReplica(t *testing.T) {
+	a, b := newFakeMaster(t, "master"), newFakeMaster(t, "master")
+	defer a.Close()
+	defer b.Close()
+	replica := newFakeMaster(t, "slave")
+	defer replica.Close()
+	sentinel := newFakeSentinel(t, a.Addr, replica.Addr())
+	defer sentinel.Close()
+
+	stats := &countStats{}
+	client := newSentinelClient(sentinel.Addr())
+	client.PoolSize = 1
+	client.Stats = stats
+	defer client.Close()
+	if addr := callAddr(t, client.CallReplica); addr != replica.Addr() {
+		t.Fatalf("was expecting %s but got %s", replica.Addr(), addr)
+	}
+
+	ahost, aport, _ := net.SplitHostPort(a.Addr())
+	bhost, bport, _ := net.SplitHostPort(b.Addr())
+	msg := fmt.Sprintf("mymaster %s %s %s %s", ahost, aport, bhost, bport)
+	sentinel.Send("*3\r\n" + bulk("message") + bulk("+switch-master") + bulk(msg))
+
+	deadline := time.Now().Add(time.Second)
+	for callAddr(t, client.Call) != b.Addr() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for master switch")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// the replica did not change, so its connection is still in use
+	dialed := stats.Count("redis connection new")
+	if addr := callAddr(t, client.CallReplica); addr != replica.Addr() {
+		t.Fatalf("was expecting %s but got %s", replica.Addr(), addr)
+	}
+	if n := stats.Count("redis connection new"); n != dialed {
+		t.Fatalf("was expecting the replica connection to be reused but %d were opened", n-dialed)
+	}
+}
+
+func TestSentinelAuth(t *testing.T) {
+	master := newFakeNode(t)
+	defer master.Close()
+	master.Handle(func(cmd, prev []string) string {
+		if cmd[0] != "AUTH" && (len(prev) == 0 || prev[0] != "AUTH secret") {
+			return "-NOAUTH Authentication required.\r\n"
+		}
+		switch cmd[0] {
+		case "ROLE":
+			return "*3\r\n" + bulk("master") + ":0\r\n*0\r\n"
+		case "GET":
+			return bulk(prev[1])
+		}
+		return "+OK\r\n"
+	})
+	sentinel := newFakeSentinel(t, master.Addr, "")
+	defer sentinel.Close()
+	handler := sentinel.handler
+	sentinel.Handle(func(cmd, prev []string) string {
+		if cmd[0] == "AUTH" {
+			if len(cmd) != 3 || cmd[1] != "watcher" || cmd[2] != "sentinel-secret" {
+				return "-WRONGPASS invalid username-password pair\r\n"
+			}
+			return "+OK\r\n"
+		}
+		return handler(cmd, prev)
+	})
+
+	client := newSentinelClient(sentinel.Addr())
+	client.Password = "secret"
+	client.DB = 2
+	client.SentinelUsername = "watcher"
+	client.SentinelPassword = "sentinel-secret"
+	defer client.Close()
+	if setup := callAddr(t, client.Call); setup != "SELECT 2" {
+		t.Fatalf("unexpected setup %q", setup)
+	}
+}
+
+func TestSentinelLost(t *testing.T) {
+	a, b := newFakeMaster(t, "master"), newFakeMaster(t, "master")
+	defer a.Close()
+	defer b.Close()
+	var mu sync.Mutex
+	current := a.Addr()
+	master := func() string {
+		mu.Lock()
+		defer mu.Unlock()
+		return current
+	}
+	first := newFakeSentinel(t, master, "")
+	defer first.Close()
+	second := newFakeSentinel(t, master, "")
+	defer second.Close()
+	subscribed := make(chan bool, 1)
+	handler := second.handler
+	second.Handle(func(cmd, prev []string) string {
+		if cmd[0] == "SUBSCRIBE" {
+			select {
+			case subscribed <- true:
+			default:
+			}
+		}
+		return handler(cmd, prev)
+	})
+
+	client := newSentinelClient(first.Addr(), second.Addr())
+	defer client.Close()
+	if addr := callAddr(t, client.Call); addr != a.Addr() {
+		t.Fatalf("was expecting %s but got %s", a.Addr(), addr)
+	}
+
+	// the followed sentinel dies, so the next one is followed instead
+	first.Close()
+	select {
+	case <-subscribed:
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting to follow the second sentinel")
+	}
+
+	mu.Lock()
+	current = b.Addr()
+	mu.Unlock()
+	ahost, aport, _ := net.SplitHostPort(a.Addr())
+	bhost, bport, _ := net.SplitHostPort(b.Addr())
+	msg := fmt.Sprintf("mymaster %s %s %s %s", ahost, aport, bhost, bport)
+	second.Send("*3\r\n" + bulk("message") + bulk("+switch-master") + bulk(msg))
+
+	deadline := time.Now().Add(time.Second)
+	for callAddr(t, client.Call) != b.Addr() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for master switch")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
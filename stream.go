@@ -0,0 +1,219 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strconv"
+	"time"
+)
+
+// ErrBulkReaderClosed is returned when reading from a closed BulkReader.
+var ErrBulkReaderClosed = errors.New("go.redis: bulk reader closed")
+
+// ReaderArg is a command argument read from R, which must provide exactly
+// Size bytes. It is copied to the connection as the command is sent instead
+// of being formatted in memory, which suits large values. The write timeout
+// applies to the whole command, so it needs to allow for the size.
+//
+//     f, err := os.Open("blob")
+//     fi, err := f.Stat()
+//     reply, err := client.Call("SET", "blob", redis.ReaderArg{R: f, Size: fi.Size()})
+type ReaderArg struct {
+	R    io.Reader
+	Size int64
+}
+
+// BulkReader streams the value of a bulk string reply from the connection.
+type BulkReader struct {
+	Size int64 // Length of the value
+
+	conn    *connection
+	left    int64
+	err     error
+	timeout time.Duration // read deadline renewed before each read
+	done    func()        // called once the connection is free
+}
+
+// Read the value. The connection is free once io.EOF is returned.
+func (b *BulkReader) Read(p []byte) (int, error) {
+	if b.err != nil {
+		return 0, b.err
+	}
+	if b.left == 0 {
+		b.end(b.readDelim())
+		return 0, b.err
+	}
+	if int64(len(p)) > b.left {
+		p = p[:b.left]
+	}
+	if b.timeout > 0 {
+		b.conn.conn.SetReadDeadline(time.Now().Add(b.timeout))
+	}
+	n, err := b.conn.rbuf.Read(p)
+	b.left -= int64(n)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		b.conn.fail(err)
+		b.end(err)
+		return n, err
+	}
+	return n, nil
+}
+
+// Close frees the connection. If the value was not read to the end, the
+// connection can no longer be used and is discarded.
+func (b *BulkReader) Close() error {
+	if b.err == nil {
+		b.conn.fail(ErrBulkReaderClosed)
+		b.end(ErrBulkReaderClosed)
+	}
+	return nil
+}
+
+// Read the \r\n terminating the value.
+func (b *BulkReader) readDelim() error {
+	var delim [2]byte
+	if _, err := io.ReadFull(b.conn.rbuf, delim[:]); err != nil {
+		b.conn.fail(err)
+		return err
+	}
+	if delim[0] != cr || delim[1] != lf {
+		err := protocolError("bulk string not terminated by CRLF")
+		b.conn.fail(err)
+		return err
+	}
+	return io.EOF
+}
+
+func (b *BulkReader) end(err error) {
+	b.err = err
+	if b.done != nil {
+		b.done()
+		b.done = nil
+	}
+}
+
+// ReadStream is like Read, except that the value of a bulk string reply is not
+// read into memory. A BulkReader for it is returned instead of a Reply, and it
+// must be read to the end before the connection is used again.
+func (c *connection) ReadStream() (*Reply, *BulkReader, error) {
+	if c.err != nil {
+		return nil, nil, c.err
+	}
+	res, err := c.rbuf.ReadSlice(lf)
+	if err != nil {
+		err = lineError(err)
+		c.fail(err)
+		return nil, nil, err
+	}
+	if res[0] != dollar || len(res) < 3 || res[len(res)-2] != cr {
+		reply := parseLine(c.rbuf, res, 0)
+		if reply.Err != nil {
+			c.fail(reply.Err)
+			return reply, nil, reply.Err
+		}
+		return reply, nil, nil
+	}
+	l, err := strconv.ParseInt(string(res[1:len(res)-2]), 10, 64)
+	if err != nil || l < -1 {
+		err = protocolError("invalid bulk string header %q", res)
+		c.fail(err)
+		return nil, nil, err
+	}
+	if l == -1 {
+		return &Reply{Kind: KindBulk}, nil, nil
+	}
+	return nil, &BulkReader{Size: l, conn: c, left: l}, nil
+}
+
+// Encode a command with ReaderArg arguments, streaming those to the
+// connection.
+func (c *connection) bufferStream(args []interface{}) error {
+	c.wbuf = appendArrayHeader(c.wbuf, len(args))
+	for _, arg := range args {
+		r, ok := arg.(ReaderArg)
+		if !ok {
+			buf, err := appendBulk(c.wbuf, arg)
+			if err != nil {
+				return err
+			}
+			c.wbuf = buf
+			continue
+		}
+		c.wbuf = appendBulkHeader(c.wbuf, r.Size)
+		c.streamed = true
+		if err := c.flush(); err != nil {
+			return err
+		}
+		if _, err := io.CopyN(c.conn, r.R, r.Size); err != nil {
+			return err
+		}
+		c.wbuf = append(c.wbuf, delim...)
+	}
+	return nil
+}
+
+// CallStream is like Call for commands replying with a bulk string, such as
+// GET, but returns a BulkReader streaming the value instead of reading it
+// into memory. The connection is held until the BulkReader is read to the end
+// or closed, so it must always be closed. The read timeout applies to each
+// read rather than to the whole value. A nil reply returns ErrNil, and a reply
+// other than a bulk string ErrUnexpectedReply.
+//
+//     r, err := client.CallStream("GET", "blob")
+//     if err != nil {
+//         return err
+//     }
+//     defer r.Close()
+//     _, err = io.Copy(w, r)
+func (c *Client) CallStream(args ...interface{}) (*BulkReader, error) {
+	conn, err := c.connect(context.Background())
+	if err != nil {
+		c.inc("redis connection accquire error")
+		return nil, err
+	}
+	b, err := c.stream(conn.connection, args)
+	if err != nil {
+		c.release(conn)
+		return nil, err
+	}
+	b.done = func() { c.release(conn) }
+	return b, nil
+}
+
+func (c *Client) stream(conn *connection, args []interface{}) (*BulkReader, error) {
+	err := c.setDeadlines(context.Background(), conn, c.readTimeout())
+	if err != nil {
+		c.inc("redis connection set deadline error")
+		return nil, err
+	}
+	if err = conn.Write(args...); err != nil {
+		c.inc("redis connection write error")
+		return nil, err
+	}
+	for {
+		reply, b, err := conn.ReadStream()
+		if err != nil {
+			c.inc("redis connection read error")
+			return nil, err
+		}
+		if b != nil {
+			b.timeout = c.readTimeout()
+			return b, nil
+		}
+		if reply.Kind == KindPush {
+			c.inc("redis connection push")
+			if c.PushHandler != nil {
+				c.PushHandler(reply)
+			}
+			continue
+		}
+		if reply.Nil() {
+			return nil, ErrNil
+		}
+		return nil, ErrUnexpectedReply
+	}
+}
@@ -0,0 +1,85 @@
+package redis_test
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/daaku/go.redis"
+	"github.com/daaku/go.redis/redistest"
+)
+
+func TestStream(t *testing.T) {
+	server, _ := redistest.NewServerClient(t)
+	defer server.Close()
+	client, _ := newPoolClient(server)
+	defer client.Close()
+	value := bytes.Repeat([]byte("0123456789"), 100000)
+	arg := redis.ReaderArg{R: bytes.NewReader(value), Size: int64(len(value))}
+	if _, err := client.Call("SET", "blob", arg); err != nil {
+		t.Fatal(err)
+	}
+	r, err := client.CallStream("GET", "blob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Size != int64(len(value)) {
+		t.Fatalf("was expecting size %d but got %d", len(value), r.Size)
+	}
+	got, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Close()
+	if !bytes.Equal(got, value) {
+		t.Fatalf("was expecting %d bytes back but got %d", len(value), len(got))
+	}
+	if _, err := client.Call("PING"); err != nil {
+		t.Fatal(err)
+	}
+	if stats := client.PoolStats(); stats.Total != 1 {
+		t.Fatalf("was expecting the connection to be reused but got %+v", stats)
+	}
+}
+
+func TestStreamErrors(t *testing.T) {
+	server, _ := redistest.NewServerClient(t)
+	defer server.Close()
+	client, _ := newPoolClient(server)
+	defer client.Close()
+	if _, err := client.CallStream("GET", "missing"); err != redis.ErrNil {
+		t.Fatalf("was expecting ErrNil but got %v", err)
+	}
+	if _, err := client.CallStream("PING"); err != redis.ErrUnexpectedReply {
+		t.Fatalf("was expecting ErrUnexpectedReply but got %v", err)
+	}
+	if _, err := client.Call("SET", "foo", "bar"); err != nil {
+		t.Fatal(err)
+	}
+
+	// closing early discards the connection
+	r, err := client.CallStream("GET", "foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Close()
+	if _, err := r.Read(make([]byte, 1)); err != redis.ErrBulkReaderClosed {
+		t.Fatalf("was expecting ErrBulkReaderClosed but got %v", err)
+	}
+	if stats := client.PoolStats(); stats.Total != 0 {
+		t.Fatalf("was expecting the connection to be closed but got %+v", stats)
+	}
+
+	// a short reader leaves a partial command on the connection
+	arg := redis.ReaderArg{R: strings.NewReader("short"), Size: 10}
+	if _, err := client.Call("SET", "foo", arg); err != io.EOF {
+		t.Fatalf("was expecting EOF but got %v", err)
+	}
+	if stats := client.PoolStats(); stats.Total != 0 {
+		t.Fatalf("was expecting the connection to be closed but got %+v", stats)
+	}
+	if value, err := client.Get("foo"); err != nil || string(value) != "bar" {
+		t.Fatalf("was expecting bar but got %q %v", value, err)
+	}
+}
@@ -0,0 +1,144 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// The number of times Transaction will run the user function when EXEC keeps
+// getting aborted because of concurrent modifications to the WATCHed keys.
+const txMaxAttempts = 16
+
+// ErrTxAborted is returned by Transaction when EXEC was aborted on every
+// attempt because one of the WATCHed keys kept changing.
+var ErrTxAborted = errors.New("go.redis: transaction aborted")
+
+// Returned by a single attempt when EXEC was aborted.
+var errExecAborted = errors.New("go.redis: exec aborted")
+
+// Tx is a transaction bound to a single connection. Commands issued using
+// Call are sent immediately, and are typically reads of the WATCHed keys.
+// Commands issued using Queue are sent inside MULTI/EXEC once the transaction
+// function returns.
+type Tx struct {
+	client *Client
+	conn   *connection
+	cmds   [][]interface{}
+}
+
+// Call sends a command outside of MULTI/EXEC and waits for its reply.
+func (tx *Tx) Call(args ...interface{}) (*Reply, error) {
+	if err := tx.conn.Write(args...); err != nil {
+		return nil, err
+	}
+	return tx.client.read(tx.conn)
+}
+
+// Queue adds a command to the MULTI/EXEC block.
+func (tx *Tx) Queue(args ...interface{}) {
+	tx.cmds = append(tx.cmds, args)
+}
+
+// Transaction pins a connection from the pool, WATCHes the given keys and
+// calls f. The commands queued by f are then executed atomically using
+// MULTI/EXEC, and their replies are returned in order. If EXEC is aborted
+// because a WATCHed key changed, the whole process including the call to f is
+// retried. If f returns an error nothing is executed and the error is
+// returned.
+//
+//     replies, err := client.Transaction(func(tx *redis.Tx) error {
+//         r, err := tx.Call("GET", "counter")
+//         if err != nil {
+//             return err
+//         }
+//         tx.Queue("SET", "counter", r.Elem.Int()*2)
+//         return nil
+//     }, "counter")
+func (c *Client) Transaction(f func(tx *Tx) error, watchKeys ...string) (replies []*Reply, err error) {
+	start := time.Now()
+	conn, err := c.connect(context.Background())
+	c.record(
+		"redis connection acquire", float64(time.Since(start).Nanoseconds()))
+	if err != nil {
+		c.inc("redis connection accquire error")
+		return nil, err
+	}
+	defer func() {
+		c.record(
+			"redis connection release", float64(time.Since(start).Nanoseconds()))
+		c.release(conn)
+	}()
+
+	for i := 0; i < txMaxAttempts; i++ {
+		replies, err = c.transaction(conn.connection, f, watchKeys)
+		if err != errExecAborted {
+			return replies, err
+		}
+		c.inc("redis transaction retry")
+	}
+	c.inc("redis transaction aborted")
+	return nil, ErrTxAborted
+}
+
+// Run a single attempt of a transaction on the given connection.
+func (c *Client) transaction(conn *connection, f func(tx *Tx) error, watchKeys []string) ([]*Reply, error) {
+	start := time.Now()
+	err := c.setDeadlines(context.Background(), conn, c.readTimeout())
+	if err != nil {
+		c.inc("redis connection set deadline error")
+		return nil, err
+	}
+
+	tx := &Tx{client: c, conn: conn}
+	if len(watchKeys) > 0 {
+		args := make([]interface{}, 0, len(watchKeys)+1)
+		args = append(args, "WATCH")
+		for _, k := range watchKeys {
+			args = append(args, k)
+		}
+		if _, err = tx.Call(args...); err != nil {
+			return nil, err
+		}
+	}
+
+	if err = f(tx); err != nil {
+		if len(watchKeys) > 0 {
+			if _, uerr := tx.Call("UNWATCH"); uerr != nil {
+				return nil, uerr
+			}
+		}
+		return nil, err
+	}
+
+	cmds := make([][]interface{}, 0, len(tx.cmds)+2)
+	cmds = append(cmds, []interface{}{"MULTI"})
+	cmds = append(cmds, tx.cmds...)
+	cmds = append(cmds, []interface{}{"EXEC"})
+	if err = conn.WriteBatch(cmds); err != nil {
+		c.inc("redis transaction write error")
+		return nil, err
+	}
+
+	// MULTI and the QUEUED replies. A command rejected while queueing makes
+	// the server abort EXEC with an error, and a broken connection makes
+	// reading the EXEC reply fail, so these replies can be discarded.
+	for i := 0; i < len(cmds)-1; i++ {
+		c.read(conn)
+	}
+
+	// Errors from individual commands are reported on their own reply, and
+	// also bubble up to the EXEC reply which we disregard in that case.
+	reply, err := c.read(conn)
+	c.record("redis transaction exec", float64(time.Since(start).Nanoseconds()))
+	if reply != nil && reply.Elems != nil {
+		return reply.Elems, nil
+	}
+	if err == ErrNilMultiBulk {
+		return nil, errExecAborted
+	}
+	if err == nil {
+		err = ErrProtocol
+	}
+	return nil, err
+}
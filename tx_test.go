@@ -0,0 +1,114 @@
+package redis_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/daaku/go.redis"
+	"github.com/daaku/go.redis/redistest"
+)
+
+func TestTransaction(t *testing.T) {
+	server, client := redistest.NewServerClient(t)
+	defer server.Close()
+	replies, err := client.Transaction(func(tx *redis.Tx) error {
+		tx.Queue("SET", "foo", "bar")
+		tx.Queue("INCR", "foo")
+		tx.Queue("GET", "foo")
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(replies) != 3 {
+		t.Fatalf("was expecting 3 replies but got %d", len(replies))
+	}
+	if replies[1].Err == nil {
+		t.Fatal("was expecting INCR on a string to fail")
+	}
+	if replies[2].Elem.String() != "bar" {
+		t.Fatalf("was expecting bar but got %s", replies[2].Elem)
+	}
+}
+
+func TestTransactionRetry(t *testing.T) {
+	server, client := redistest.NewServerClient(t)
+	defer server.Close()
+	if _, err := client.Call("SET", "counter", 1); err != nil {
+		t.Fatal(err)
+	}
+	attempts := 0
+	replies, err := client.Transaction(func(tx *redis.Tx) error {
+		attempts++
+		r, err := tx.Call("GET", "counter")
+		if err != nil {
+			return err
+		}
+		if attempts == 1 {
+			// modify the watched key from another connection
+			if _, err := client.Call("SET", "counter", 10); err != nil {
+				return err
+			}
+		}
+		tx.Queue("SET", "counter", r.Elem.Int()*2)
+		tx.Queue("GET", "counter")
+		return nil
+	}, "counter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if attempts != 2 {
+		t.Fatalf("was expecting 2 attempts but got %d", attempts)
+	}
+	if replies[1].Elem.String() != "20" {
+		t.Fatalf("was expecting 20 but got %s", replies[1].Elem)
+	}
+}
+
+func TestTransactionFuncError(t *testing.T) {
+	server, client := redistest.NewServerClient(t)
+	defer server.Close()
+	expected := errors.New("expected")
+	_, err := client.Transaction(func(tx *redis.Tx) error {
+		tx.Queue("SET", "foo", "bar")
+		return expected
+	}, "foo")
+	if err != expected {
+		t.Fatalf("was expecting %s but got %v", expected, err)
+	}
+	r, err := client.Call("EXISTS", "foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Elem.Int() != 0 {
+		t.Fatal("was not expecting foo to be set")
+	}
+}
+
+func TestTransactionFuncNilMultiBulk(t *testing.T) {
+	server, client := redistest.NewServerClient(t)
+	defer server.Close()
+	calls := 0
+	_, err := client.Transaction(func(tx *redis.Tx) error {
+		calls++
+		return redis.ErrNilMultiBulk
+	}, "foo")
+	if err != redis.ErrNilMultiBulk {
+		t.Fatalf("was expecting ErrNilMultiBulk but got %v", err)
+	}
+	if calls != 1 {
+		t.Fatalf("was expecting a single attempt but got %d", calls)
+	}
+}
+
+func TestTransactionQueueError(t *testing.T) {
+	server, client := redistest.NewServerClient(t)
+	defer server.Close()
+	_, err := client.Transaction(func(tx *redis.Tx) error {
+		tx.Queue("SET", "foo")
+		return nil
+	})
+	if err == nil {
+		t.Fatal("was expecting EXECABORT error")
+	}
+}